@@ -0,0 +1,76 @@
+package admission
+
+import (
+	"fmt"
+)
+
+// Action is what happens when a rule is violated
+type Action string
+
+const (
+	// ActionDeny rejects the request
+	ActionDeny Action = "deny"
+	// ActionWarn allows the request and returns the violation as a warning kubectl prints
+	ActionWarn Action = "warn"
+	// ActionAudit allows the request silently, the violation is only logged and
+	// added to the API server audit log through AuditAnnotations
+	ActionAudit Action = "audit"
+)
+
+// Actions lists every valid action
+var Actions = []Action{ActionDeny, ActionWarn, ActionAudit}
+
+// ParseAction validates an action name, empty means deny
+func ParseAction(s string) (Action, error) {
+	if s == "" {
+		return ActionDeny, nil
+	}
+	for _, a := range Actions {
+		if Action(s) == a {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown action %q (supported: %v)", s, Actions)
+}
+
+// Enforce wraps a rule so its violations use the given action instead of deny
+func Enforce(rule Rule, action Action) Rule {
+	if e, ok := rule.(*enforcedRule); ok {
+		rule = e.Rule
+	}
+	return &enforcedRule{Rule: rule, action: action}
+}
+
+// EnforceObject is Enforce for object rules
+func EnforceObject(rule ObjectRule, action Action) ObjectRule {
+	if e, ok := rule.(*enforcedObjectRule); ok {
+		rule = e.ObjectRule
+	}
+	return &enforcedObjectRule{ObjectRule: rule, action: action}
+}
+
+// ActionOf returns the action of a rule or object rule, deny unless it was wrapped by Enforce or EnforceObject
+func ActionOf(rule interface{ Name() string }) Action {
+	if e, ok := rule.(enforced); ok {
+		return e.enforcedAction()
+	}
+	return ActionDeny
+}
+
+type enforced interface {
+	enforcedAction() Action
+}
+
+type enforcedRule struct {
+	Rule
+	action Action
+}
+
+func (e *enforcedRule) enforcedAction() Action { return e.action }
+
+type enforcedObjectRule struct {
+	ObjectRule
+	action Action
+}
+
+func (e *enforcedObjectRule) enforcedAction() Action { return e.action }
@@ -0,0 +1,239 @@
+// Package ceilings caps the resources pods may claim, per namespace: the highest limit a container
+// may set, how far its limit may exceed its request and the total limits of a pod. It is the
+// LimitRange max / maxLimitRequestRatio checked at admission time, for pods and workload templates,
+// with namespaces chosen by label selectors instead of one object per namespace.
+//
+// resource-limits only checks that limits exist; without ceilings a container can ask for 64Gi with a
+// tiny request, get scheduled on the request and starve its node.
+package ceilings
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Name identifies the resourceCeilings block as a rule
+const Name = "resource-ceilings"
+
+// Resources that can have ceilings
+var Resources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage}
+
+// Config is the resourceCeilings block of the policy file.
+//
+//	ceilings:
+//	  - name: teams
+//	    namespaceSelector:
+//	      matchLabels: {tier: team}
+//	    maxContainerLimits: {cpu: "4", memory: 8Gi, ephemeral-storage: 10Gi}
+//	    maxLimitRequestRatio: {cpu: "4", memory: "2"}
+//	    maxPodLimits: {cpu: "8", memory: 16Gi}
+type Config struct {
+	Ceilings []Ceiling `json:"ceilings"`
+}
+
+// Ceiling applies to the namespaces its selector matches. A namespace matched by several
+// ceilings has to satisfy all of them.
+type Ceiling struct {
+	// Name identifies the ceiling in messages, defaults to its index
+	Name string `json:"name,omitempty"`
+	// NamespaceSelector selects namespaces by label, omitted means every namespace.
+	// kubernetes.io/metadata.name selects namespaces by name.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// MaxContainerLimits is the highest limit any container may set; a container without a limit
+	// for a resource listed here is rejected, it would be unbounded
+	MaxContainerLimits corev1.ResourceList `json:"maxContainerLimits,omitempty"`
+	// MaxLimitRequestRatio bounds limit / request per container; without a request the API server
+	// uses the limit, which is a ratio of 1
+	MaxLimitRequestRatio corev1.ResourceList `json:"maxLimitRequestRatio,omitempty"`
+	// MaxPodLimits bounds the limits of the whole pod, as the scheduler adds them up, pod overhead included
+	MaxPodLimits corev1.ResourceList `json:"maxPodLimits,omitempty"`
+}
+
+// New builds the rule
+func New(cfg Config) (admission.ObjectRule, error) {
+	if len(cfg.Ceilings) == 0 {
+		return nil, errors.New("ceilings must not be empty")
+	}
+	var errs []error
+	r := &rule{}
+	for i, c := range cfg.Ceilings {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("ceilings[%d]", i)
+		}
+		compiled := ceiling{Ceiling: c, selector: labels.Everything()}
+		if c.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(c.NamespaceSelector)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: namespaceSelector: %w", c.Name, err))
+			}
+			compiled.selector = selector
+		}
+		if len(c.MaxContainerLimits) == 0 && len(c.MaxLimitRequestRatio) == 0 && len(c.MaxPodLimits) == 0 {
+			errs = append(errs, fmt.Errorf("%s: sets no maxContainerLimits, maxLimitRequestRatio or maxPodLimits", c.Name))
+		}
+		for _, field := range []struct {
+			name string
+			list corev1.ResourceList
+			min  resource.Quantity
+		}{
+			{"maxContainerLimits", c.MaxContainerLimits, resource.Quantity{}},
+			{"maxLimitRequestRatio", c.MaxLimitRequestRatio, resource.MustParse("1")},
+			{"maxPodLimits", c.MaxPodLimits, resource.Quantity{}},
+		} {
+			for _, name := range slices.Sorted(maps.Keys(field.list)) {
+				q := field.list[name]
+				switch {
+				case !slices.Contains(Resources, name):
+					errs = append(errs, fmt.Errorf("%s: %s: unsupported resource %q (supported: %v)", c.Name, field.name, name, Resources))
+				case q.Sign() <= 0:
+					errs = append(errs, fmt.Errorf("%s: %s: %s must be positive", c.Name, field.name, name))
+				case q.Cmp(field.min) < 0:
+					errs = append(errs, fmt.Errorf("%s: %s: %s must be at least %s", c.Name, field.name, name, field.min.String()))
+				}
+			}
+		}
+		r.ceilings = append(r.ceilings, compiled)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type ceiling struct {
+	Ceiling
+	selector labels.Selector
+}
+
+type rule struct {
+	ceilings []ceiling
+}
+
+func (r *rule) Name() string                 { return Name }
+func (r *rule) Severity() admission.Severity { return admission.SeverityMedium }
+
+func (r *rule) EvaluateObject(req *admission.ObjectRequest) []admission.Violation {
+	if req.Namespace == "" {
+		return nil
+	}
+	pod, ok, err := req.Pod()
+	if err != nil || !ok {
+		return nil
+	}
+	nsLabels, err := req.NamespaceLabels()
+	if err != nil {
+		return []admission.Violation{admission.Violationf("could not look up namespace %q: %v", req.Namespace, err)}
+	}
+
+	var violations []admission.Violation
+	for _, c := range r.ceilings {
+		if c.selector.Matches(labels.Set(nsLabels)) {
+			violations = append(violations, c.evaluate(pod)...)
+		}
+	}
+	return violations
+}
+
+func (c ceiling) evaluate(pod *corev1.Pod) []admission.Violation {
+	var violations []admission.Violation
+	for _, ref := range admission.AllContainers(pod) {
+		// The API server does not allow resources on ephemeral containers
+		if ref.Kind == admission.KindEphemeralContainer {
+			continue
+		}
+		res := ref.Container.Resources
+		for _, name := range Resources {
+			if ceil, ok := c.MaxContainerLimits[name]; ok {
+				limit, set := res.Limits[name]
+				switch {
+				case !set:
+					violations = append(violations, admission.Violationf("%s: %s limit must be set, at most %s (%s)", ref, name, ceil.String(), c.Name))
+				case limit.Cmp(ceil) > 0:
+					violations = append(violations, admission.Violationf("%s: %s limit %s exceeds the maximum %s (%s)", ref, name, limit.String(), ceil.String(), c.Name))
+				}
+			}
+			limit, hasLimit := res.Limits[name]
+			request, hasRequest := res.Requests[name]
+			maxRatio, ok := c.MaxLimitRequestRatio[name]
+			if !ok || !hasLimit || !hasRequest || limit.Sign() <= 0 {
+				continue
+			}
+			if request.Sign() <= 0 {
+				violations = append(violations, admission.Violationf("%s: %s request must not be 0 next to a limit, the limit may be at most %s times the request (%s)",
+					ref, name, maxRatio.String(), c.Name))
+				continue
+			}
+			if ratio := limit.AsApproximateFloat64() / request.AsApproximateFloat64(); ratio > maxRatio.AsApproximateFloat64() {
+				violations = append(violations, admission.Violationf("%s: %s limit %s is %.1f times the request %s, at most %s allowed (%s)",
+					ref, name, limit.String(), ratio, request.String(), maxRatio.String(), c.Name))
+			}
+		}
+	}
+
+	for _, name := range Resources {
+		ceil, ok := c.MaxPodLimits[name]
+		if !ok {
+			continue
+		}
+		total, unbounded := podLimit(pod, name)
+		switch {
+		case len(unbounded) > 0:
+			violations = append(violations, admission.Violationf("pod %s limit is unbounded, %s set no %s limit; at most %s per pod (%s)",
+				name, strings.Join(unbounded, ", "), name, ceil.String(), c.Name))
+		case total.Cmp(ceil) > 0:
+			violations = append(violations, admission.Violationf("pod %s limits add up to %s, more than the maximum %s per pod (%s)", name, total.String(), ceil.String(), c.Name))
+		}
+	}
+	return violations
+}
+
+// podLimit is the effective pod limit the way the scheduler computes it: all containers and
+// sidecars (restartable init containers) run together, other init containers one at a time next
+// to the sidecars started before them, plus the RuntimeClass overhead of the pod.
+// unbounded lists the containers that set no limit.
+func podLimit(pod *corev1.Pod, name corev1.ResourceName) (total resource.Quantity, unbounded []string) {
+	limitOf := func(kind string, c *corev1.Container) resource.Quantity {
+		q, ok := c.Resources.Limits[name]
+		if !ok {
+			unbounded = append(unbounded, admission.ContainerRef{Kind: kind, Container: c}.String())
+		}
+		return q
+	}
+
+	var sidecars, initMax resource.Quantity
+	for i := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[i]
+		q := limitOf(admission.KindInitContainer, c)
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecars.Add(q)
+			continue
+		}
+		// A regular init container runs next to the sidecars started before it
+		q.Add(sidecars)
+		if q.Cmp(initMax) > 0 {
+			initMax = q
+		}
+	}
+	total = sidecars.DeepCopy()
+	for i := range pod.Spec.Containers {
+		total.Add(limitOf(admission.KindContainer, &pod.Spec.Containers[i]))
+	}
+	if initMax.Cmp(total) > 0 {
+		total = initMax
+	}
+	// Set by the API server from the RuntimeClass, e.g. the VM of a Kata container
+	if overhead, ok := pod.Spec.Overhead[name]; ok {
+		total.Add(overhead)
+	}
+	return total, unbounded
+}
@@ -0,0 +1,129 @@
+package ceilings
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// limited is a container with a memory limit, "" leaves it unbounded
+func limited(name, memory string) corev1.Container {
+	c := corev1.Container{Name: name, Image: "nginx:1.27"}
+	if memory != "" {
+		c.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memory)}
+	}
+	return c
+}
+
+func sidecar(name, memory string) corev1.Container {
+	c := limited(name, memory)
+	always := corev1.ContainerRestartPolicyAlways
+	c.RestartPolicy = &always
+	return c
+}
+
+func TestPodLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		init       []corev1.Container
+		containers []corev1.Container
+		overhead   string
+		want       string
+		unbounded  []string
+	}{
+		{"containers add up", nil, []corev1.Container{limited("a", "1Gi"), limited("b", "2Gi")}, "", "3Gi", nil},
+		{"larger init container wins", []corev1.Container{limited("migrate", "4Gi")},
+			[]corev1.Container{limited("app", "1Gi")}, "", "4Gi", nil},
+		{"init containers run one at a time", []corev1.Container{limited("one", "1Gi"), limited("two", "1Gi")},
+			[]corev1.Container{limited("a", "1Gi"), limited("b", "1Gi")}, "", "2Gi", nil},
+		{"sidecar runs next to the containers", []corev1.Container{sidecar("proxy", "512Mi")},
+			[]corev1.Container{limited("app", "1Gi")}, "", "1536Mi", nil},
+		{"init container after a sidecar runs next to it", []corev1.Container{sidecar("proxy", "1Gi"), limited("migrate", "3Gi")},
+			[]corev1.Container{limited("app", "1Gi")}, "", "4Gi", nil},
+		{"init container before a sidecar runs alone", []corev1.Container{limited("migrate", "3Gi"), sidecar("proxy", "1Gi")},
+			[]corev1.Container{limited("app", "1Gi")}, "", "3Gi", nil},
+		{"sidecars started before add up", []corev1.Container{sidecar("proxy", "1Gi"), sidecar("log", "1Gi"), limited("migrate", "1Gi")},
+			[]corev1.Container{limited("app", "512Mi")}, "", "3Gi", nil},
+		{"overhead", nil, []corev1.Container{limited("app", "1Gi")}, "256Mi", "1280Mi", nil},
+		{"overhead on top of an init container", []corev1.Container{sidecar("proxy", "1Gi"), limited("migrate", "3Gi")},
+			[]corev1.Container{limited("app", "1Gi")}, "256Mi", "4352Mi", nil},
+		{"unbounded containers", []corev1.Container{sidecar("proxy", ""), limited("migrate", "")},
+			[]corev1.Container{limited("app", "1Gi"), limited("worker", "")}, "", "1Gi",
+			[]string{`initContainer "proxy"`, `initContainer "migrate"`, `container "worker"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{InitContainers: tt.init, Containers: tt.containers}}
+			if tt.overhead != "" {
+				pod.Spec.Overhead = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(tt.overhead)}
+			}
+			total, unbounded := podLimit(pod, corev1.ResourceMemory)
+			if want := resource.MustParse(tt.want); total.Cmp(want) != 0 {
+				t.Errorf("total = %s, want %s", total.String(), want.String())
+			}
+			if !slices.Equal(unbounded, tt.unbounded) {
+				t.Errorf("unbounded = %q, want %q", unbounded, tt.unbounded)
+			}
+		})
+	}
+}
+
+func TestMaxPodLimits(t *testing.T) {
+	rule, err := New(Config{Ceilings: []Ceiling{{
+		Name:         "teams",
+		MaxPodLimits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")},
+	}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	namespaces := func(_ context.Context, name string) (*corev1.Namespace, error) {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+	}
+
+	tests := []struct {
+		name      string
+		pod       string
+		violation string
+	}{
+		{"within the maximum", `{"spec":{"initContainers":[{"name":"proxy","restartPolicy":"Always","resources":{"limits":{"memory":"1Gi"}}}],` +
+			`"containers":[{"name":"app","resources":{"limits":{"memory":"3Gi"}}}]}}`, ""},
+		{"sidecar pushes it over", `{"spec":{"initContainers":[{"name":"proxy","restartPolicy":"Always","resources":{"limits":{"memory":"2Gi"}}}],` +
+			`"containers":[{"name":"app","resources":{"limits":{"memory":"3Gi"}}}]}}`,
+			"pod memory limits add up to 5Gi, more than the maximum 4Gi per pod (teams)"},
+		{"overhead pushes it over", `{"spec":{"overhead":{"memory":"512Mi"},"containers":[{"name":"app","resources":{"limits":{"memory":"4Gi"}}}]}}`,
+			"pod memory limits add up to 4608Mi"},
+		{"unbounded sidecar", `{"spec":{"initContainers":[{"name":"proxy","restartPolicy":"Always"}],` +
+			`"containers":[{"name":"app","resources":{"limits":{"memory":"1Gi"}}}]}}`,
+			`pod memory limit is unbounded, initContainer "proxy" set no memory limit; at most 4Gi per pod (teams)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := admission.NewObjectRequest(context.Background(), &admissionv1.AdmissionRequest{
+				UID:       "1",
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Operation: admissionv1.Create,
+				Namespace: "team-a",
+				Object:    runtime.RawExtension{Raw: []byte(tt.pod)},
+			}, namespaces)
+			got := rule.EvaluateObject(req)
+			if tt.violation == "" {
+				if len(got) > 0 {
+					t.Fatalf("got %v, want no violations", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.Contains(got[0].Message, tt.violation) {
+				t.Fatalf("got %v, want %q", got, tt.violation)
+			}
+		})
+	}
+}
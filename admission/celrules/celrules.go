@@ -0,0 +1,261 @@
+// Package celrules builds object rules from CEL expressions, with the variables and
+// semantics of a Kubernetes ValidatingAdmissionPolicy:
+//
+//	object           the admitted object, null on DELETE
+//	oldObject        the object before the change, null on CREATE
+//	request          the AdmissionRequest (kind, name, namespace, operation, userInfo, dryRun, ...)
+//	namespaceObject  the namespace of the object, null for cluster scoped objects
+//
+// A validation passes when its expression is true. Expressions are compiled and
+// type checked when the policy is loaded and every evaluation is bounded by a cost limit.
+package celrules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"admission"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+)
+
+// DefaultCostLimit is the cost budget of a single expression evaluation,
+// the same as the per call limit of the Kubernetes API server
+const DefaultCostLimit uint64 = 1000000
+
+// Config is a CEL rule in the policy file.
+//
+//	name: replicas-limit
+//	severity: medium
+//	matchConditions:
+//	  - name: deployments-only
+//	    expression: request.kind.kind == 'Deployment'
+//	validations:
+//	  - expression: object.spec.replicas <= 5
+//	    messageExpression: "'replicas must be <= 5, got ' + string(object.spec.replicas)"
+type Config struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity,omitempty"`
+	// MatchConditions must all be true for the validations to run
+	MatchConditions []MatchCondition `json:"matchConditions,omitempty"`
+	Validations     []Validation     `json:"validations"`
+}
+
+// MatchCondition narrows the requests a rule applies to
+type MatchCondition struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// Validation is a single expression that must be true.
+// MessageExpression wins over Message when it evaluates to a non empty string.
+type Validation struct {
+	Expression        string `json:"expression"`
+	Message           string `json:"message,omitempty"`
+	MessageExpression string `json:"messageExpression,omitempty"`
+}
+
+var env = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("oldObject", cel.DynType),
+		cel.Variable("request", cel.DynType),
+		cel.Variable("namespaceObject", cel.DynType),
+		cel.CrossTypeNumericComparisons(true),
+		cel.DefaultUTCTimeZone(true),
+		cel.OptionalTypes(),
+		ext.Strings(),
+		ext.Lists(),
+		ext.Sets(),
+	)
+})
+
+// Compile checks every expression of the rule and reports all problems at once
+func Compile(cfg Config, costLimit uint64) (admission.ObjectRule, error) {
+	e, err := env()
+	if err != nil {
+		return nil, fmt.Errorf("CEL environment: %w", err)
+	}
+	if costLimit == 0 {
+		costLimit = DefaultCostLimit
+	}
+
+	var errs []error
+	if cfg.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	severity, err := admission.ParseSeverity(cfg.Severity, admission.SeverityMedium)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(cfg.Validations) == 0 {
+		errs = append(errs, errors.New("validations must not be empty"))
+	}
+
+	r := &rule{name: cfg.Name, severity: severity}
+	for i, mc := range cfg.MatchConditions {
+		if mc.Name == "" {
+			errs = append(errs, fmt.Errorf("matchConditions[%d]: name is required", i))
+		}
+		prg, err := compile(e, mc.Expression, cel.BoolType, costLimit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("matchConditions[%d].expression: %w", i, err))
+			continue
+		}
+		r.matchConditions = append(r.matchConditions, matchCondition{name: mc.Name, program: prg})
+	}
+	for i, v := range cfg.Validations {
+		prg, err := compile(e, v.Expression, cel.BoolType, costLimit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("validations[%d].expression: %w", i, err))
+			continue
+		}
+		compiled := validation{expression: v.Expression, message: v.Message, program: prg}
+		if v.MessageExpression != "" {
+			if compiled.messageProgram, err = compile(e, v.MessageExpression, cel.StringType, costLimit); err != nil {
+				errs = append(errs, fmt.Errorf("validations[%d].messageExpression: %w", i, err))
+				continue
+			}
+		}
+		r.validations = append(r.validations, compiled)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// compile parses and type checks an expression; with dynamic inputs the result may also be dyn
+func compile(e *cel.Env, expression string, want *cel.Type, costLimit uint64) (cel.Program, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, errors.New("expression is required")
+	}
+	ast, issues := e.Compile(expression)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if out := ast.OutputType(); !out.IsExactType(want) && !out.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("must evaluate to %s, not %s", want, out)
+	}
+	return e.Program(ast, cel.CostLimit(costLimit))
+}
+
+type matchCondition struct {
+	name    string
+	program cel.Program
+}
+
+type validation struct {
+	expression     string
+	message        string
+	program        cel.Program
+	messageProgram cel.Program
+}
+
+type rule struct {
+	name            string
+	severity        admission.Severity
+	matchConditions []matchCondition
+	validations     []validation
+}
+
+func (r *rule) Name() string                 { return r.name }
+func (r *rule) Severity() admission.Severity { return r.severity }
+
+// EvaluateObject fails closed: an expression that errors, for example by running
+// over the cost limit or reading a missing field, is reported as a violation
+func (r *rule) EvaluateObject(req *admission.ObjectRequest) []admission.Violation {
+	vars := activation(req)
+
+	for _, mc := range r.matchConditions {
+		matched, err := evalBool(mc.program, vars)
+		if err != nil {
+			return []admission.Violation{admission.Violationf("matchCondition %q could not be evaluated: %v", mc.name, err)}
+		}
+		if !matched {
+			return nil
+		}
+	}
+
+	var violations []admission.Violation
+	for _, v := range r.validations {
+		ok, err := evalBool(v.program, vars)
+		if err != nil {
+			violations = append(violations, admission.Violationf("expression %q could not be evaluated: %v", v.expression, err))
+			continue
+		}
+		if !ok {
+			violations = append(violations, admission.Violation{Message: v.failureMessage(vars)})
+		}
+	}
+	return violations
+}
+
+// failureMessage follows ValidatingAdmissionPolicy: messageExpression, then message, then the expression itself
+func (v validation) failureMessage(vars map[string]any) string {
+	if v.messageProgram != nil {
+		out, _, err := v.messageProgram.Eval(vars)
+		if err == nil {
+			if msg, ok := out.Value().(string); ok && strings.TrimSpace(msg) != "" {
+				return msg
+			}
+		}
+	}
+	if v.message != "" {
+		return v.message
+	}
+	return "failed expression: " + v.expression
+}
+
+func evalBool(program cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, not bool", out.Type())
+	}
+	return b, nil
+}
+
+// activation resolves the variables lazily so an expression only pays for what it reads
+func activation(req *admission.ObjectRequest) map[string]any {
+	return map[string]any{
+		"object":          lazy(req.Object),
+		"oldObject":       lazy(req.OldObject),
+		"namespaceObject": lazy(req.NamespaceObject),
+		"request": lazy(func() (map[string]any, error) {
+			raw, err := json.Marshal(req.AdmissionRequest)
+			if err != nil {
+				return nil, err
+			}
+			info, err := admission.Unstructured(raw)
+			if err != nil {
+				return nil, err
+			}
+			delete(info, "object")
+			delete(info, "oldObject")
+			return info, nil
+		}),
+	}
+}
+
+func lazy(get func() (map[string]any, error)) func() ref.Val {
+	return sync.OnceValue(func() ref.Val {
+		obj, err := get()
+		if err != nil {
+			return types.NewErr("%v", err)
+		}
+		if obj == nil {
+			return types.NullValue
+		}
+		return types.DefaultTypeAdapter.NativeToValue(obj)
+	})
+}
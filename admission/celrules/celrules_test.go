@@ -0,0 +1,224 @@
+package celrules
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestCompileErrors(t *testing.T) {
+	valid := []Validation{{Expression: "true"}}
+	tests := []struct {
+		name string
+		cfg  Config
+		err  string
+	}{
+		{"no name", Config{Validations: valid}, "name is required"},
+		{"unknown severity", Config{Name: "r", Severity: "urgent", Validations: valid}, `unknown severity "urgent"`},
+		{"no validations", Config{Name: "r"}, "validations must not be empty"},
+		{"empty expression", Config{Name: "r", Validations: []Validation{{Expression: " "}}}, "validations[0].expression: expression is required"},
+		{"syntax error", Config{Name: "r", Validations: []Validation{{Expression: "object.spec.replicas <="}}}, "validations[0].expression"},
+		{"undeclared variable", Config{Name: "r", Validations: []Validation{{Expression: "pod.spec != null"}}}, "undeclared reference to 'pod'"},
+		{"not a bool", Config{Name: "r", Validations: []Validation{{Expression: "1 + 1"}}}, "must evaluate to bool, not int"},
+		{
+			"message expression not a string",
+			Config{Name: "r", Validations: []Validation{{Expression: "true", MessageExpression: "42"}}},
+			"validations[0].messageExpression: must evaluate to string, not int",
+		},
+		{
+			"match condition without name",
+			Config{Name: "r", MatchConditions: []MatchCondition{{Expression: "true"}}, Validations: valid},
+			"matchConditions[0]: name is required",
+		},
+		{
+			"match condition not a bool",
+			Config{Name: "r", MatchConditions: []MatchCondition{{Name: "m", Expression: "'pods'"}}, Validations: valid},
+			"matchConditions[0].expression: must evaluate to bool, not string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.cfg, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Compile error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCompileReportsAllProblems(t *testing.T) {
+	_, err := Compile(Config{Validations: []Validation{{Expression: "1"}, {Expression: ""}}}, 0)
+	if err == nil {
+		t.Fatal("Compile accepted a broken rule")
+	}
+	for _, want := range []string{"name is required", "validations[0]", "validations[1]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+const deployment = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","labels":{"team":"payments"}},` +
+	`"spec":{"replicas":7,"template":{"spec":{"containers":[{"name":"app","image":"nginx"}]}}}}`
+
+func request(namespace, object string) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:       "1",
+		Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Operation: admissionv1.Create,
+		Namespace: namespace,
+		Object:    runtime.RawExtension{Raw: []byte(object)},
+	}
+}
+
+func TestEvaluateObject(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		costLimit  uint64
+		violations []string
+	}{
+		{
+			name:       "passes",
+			cfg:        Config{Validations: []Validation{{Expression: "object.spec.replicas <= 10"}}},
+			violations: nil,
+		},
+		{
+			name:       "falls back to the expression",
+			cfg:        Config{Validations: []Validation{{Expression: "object.spec.replicas <= 5"}}},
+			violations: []string{"failed expression: object.spec.replicas <= 5"},
+		},
+		{
+			name:       "message",
+			cfg:        Config{Validations: []Validation{{Expression: "object.spec.replicas <= 5", Message: "at most 5 replicas"}}},
+			violations: []string{"at most 5 replicas"},
+		},
+		{
+			name: "message expression wins over message",
+			cfg: Config{Validations: []Validation{{
+				Expression:        "object.spec.replicas <= 5",
+				Message:           "at most 5 replicas",
+				MessageExpression: "'got ' + string(object.spec.replicas) + ' replicas'",
+			}}},
+			violations: []string{"got 7 replicas"},
+		},
+		{
+			name: "empty message expression falls back to message",
+			cfg: Config{Validations: []Validation{{
+				Expression:        "object.spec.replicas <= 5",
+				Message:           "at most 5 replicas",
+				MessageExpression: "''",
+			}}},
+			violations: []string{"at most 5 replicas"},
+		},
+		{
+			name: "every failed validation is reported",
+			cfg: Config{Validations: []Validation{
+				{Expression: "object.spec.replicas <= 5", Message: "replicas"},
+				{Expression: "object.metadata.name.startsWith('web')", Message: "name"},
+				{Expression: "'owner' in object.metadata.labels", Message: "owner"},
+			}},
+			violations: []string{"replicas", "owner"},
+		},
+		{
+			name: "match condition false skips the rule",
+			cfg: Config{
+				MatchConditions: []MatchCondition{{Name: "pods-only", Expression: "request.kind.kind == 'Pod'"}},
+				Validations:     []Validation{{Expression: "false"}},
+			},
+			violations: nil,
+		},
+		{
+			name: "all match conditions must hold",
+			cfg: Config{
+				MatchConditions: []MatchCondition{
+					{Name: "deployments", Expression: "request.kind.kind == 'Deployment'"},
+					{Name: "payments", Expression: "object.metadata.labels.team == 'payments'"},
+				},
+				Validations: []Validation{{Expression: "false", Message: "matched"}},
+			},
+			violations: []string{"matched"},
+		},
+		{
+			name: "match condition error fails closed",
+			cfg: Config{
+				MatchConditions: []MatchCondition{{Name: "owner", Expression: "object.metadata.labels.owner == 'x'"}},
+				Validations:     []Validation{{Expression: "true"}},
+			},
+			violations: []string{`matchCondition "owner" could not be evaluated: no such key: owner`},
+		},
+		{
+			name:       "missing field fails closed",
+			cfg:        Config{Validations: []Validation{{Expression: "object.spec.paused == false"}}},
+			violations: []string{`expression "object.spec.paused == false" could not be evaluated: no such key: paused`},
+		},
+		{
+			name:       "has() guards a missing field",
+			cfg:        Config{Validations: []Validation{{Expression: "!has(object.spec.paused) || object.spec.paused == false"}}},
+			violations: nil,
+		},
+		{
+			name:       "cost limit",
+			cfg:        Config{Validations: []Validation{{Expression: "[1, 2, 3, 4, 5, 6, 7, 8].map(x, x * 2).size() > 0"}}},
+			costLimit:  5,
+			violations: []string{"could not be evaluated: operation cancelled: actual cost limit exceeded"},
+		},
+		{
+			name:       "old object is null on create",
+			cfg:        Config{Validations: []Validation{{Expression: "oldObject == null"}}},
+			violations: nil,
+		},
+		{
+			name:       "namespace object is null for cluster scoped objects",
+			cfg:        Config{Validations: []Validation{{Expression: "namespaceObject == null"}}},
+			violations: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "test"
+			rule, err := Compile(tt.cfg, tt.costLimit)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			got := rule.EvaluateObject(admission.NewObjectRequest(context.Background(), request("", deployment), nil))
+			if len(got) != len(tt.violations) {
+				t.Fatalf("got violations %v, want %q", got, tt.violations)
+			}
+			for i, v := range got {
+				if !strings.Contains(v.Message, tt.violations[i]) {
+					t.Errorf("violation %d = %q, want %q", i, v.Message, tt.violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateObjectNamespace(t *testing.T) {
+	rule, err := Compile(Config{
+		Name:            "team-label-in-prod",
+		MatchConditions: []MatchCondition{{Name: "prod", Expression: "namespaceObject.metadata.labels.env == 'prod'"}},
+		Validations:     []Validation{{Expression: "'team' in object.metadata.labels", Message: "team label required in prod"}},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	namespaces := func(ctx context.Context, name string) (*corev1.Namespace, error) {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": name}}}, nil
+	}
+	unlabelled := `{"metadata":{"name":"web"},"spec":{}}`
+
+	if got := rule.EvaluateObject(admission.NewObjectRequest(context.Background(), request("prod", unlabelled), namespaces)); len(got) != 1 {
+		t.Errorf("prod: got %v, want the team label violation", got)
+	}
+	if got := rule.EvaluateObject(admission.NewObjectRequest(context.Background(), request("dev", unlabelled), namespaces)); len(got) != 0 {
+		t.Errorf("dev: got %v, want none", got)
+	}
+}
@@ -0,0 +1,42 @@
+package admission
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Container kinds as they appear in violation messages
+const (
+	KindInitContainer      = "initContainer"
+	KindContainer          = "container"
+	KindEphemeralContainer = "ephemeralContainer"
+)
+
+// ContainerRef is a container together with the list it came from
+type ContainerRef struct {
+	Kind      string
+	Container *corev1.Container
+}
+
+func (c ContainerRef) String() string {
+	return fmt.Sprintf("%s %q", c.Kind, c.Container.Name)
+}
+
+// AllContainers returns initContainers, containers and ephemeralContainers of the pod.
+// Rules should always use it so that no container list is skipped.
+func AllContainers(pod *corev1.Pod) []ContainerRef {
+	refs := make([]ContainerRef, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers)+len(pod.Spec.EphemeralContainers))
+	for i := range pod.Spec.InitContainers {
+		refs = append(refs, ContainerRef{Kind: KindInitContainer, Container: &pod.Spec.InitContainers[i]})
+	}
+	for i := range pod.Spec.Containers {
+		refs = append(refs, ContainerRef{Kind: KindContainer, Container: &pod.Spec.Containers[i]})
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		// EphemeralContainerCommon has exactly the same fields as Container
+		c := (*corev1.Container)(&pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		refs = append(refs, ContainerRef{Kind: KindEphemeralContainer, Container: c})
+	}
+	return refs
+}
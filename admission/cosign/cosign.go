@@ -0,0 +1,257 @@
+// Package cosign verifies cosign signatures of container images against public keys from the
+// policy, the equivalent of `cosign verify --key cosign.pub` for every admitted image.
+//
+// Signatures are read from the registry the way cosign stores them: an image tagged
+// sha256-<digest>.sig next to the signed image, one layer per signature with the simple signing
+// payload as blob and the base64 signature in the dev.cosignproject.cosign/signature annotation.
+// Transparency log entries are not checked, the keys from the policy are the trust root.
+//
+// Images that match a policy must be pinned by digest: a tag can be moved to an unsigned image
+// between admission and the pull. Successful verifications are cached by digest, so an image is
+// only fetched once. Anything that can not be verified, including an unreachable registry, is a violation.
+package cosign
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"admission"
+	"admission/image"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Name of the rule in logs, metrics and exceptions
+const Name = "image-signatures"
+
+// Defaults for the zero values of Config
+const (
+	DefaultTimeout  = 3 * time.Second
+	DefaultCacheTTL = time.Hour
+)
+
+// Config is the imageSignatures block of the policy file.
+//
+//	images:
+//	  - pattern: "ghcr.io/cooler-sai/**"
+//	    keys:
+//	      - |
+//	        -----BEGIN PUBLIC KEY-----
+//	        ...
+//	        -----END PUBLIC KEY-----
+//	insecureRegistries: ["registry.local:5000"]
+//	timeoutSeconds: 3
+type Config struct {
+	// Images lists which images must be signed by whom. An image that matches several
+	// entries needs a valid signature for each of them; images that match none are not checked.
+	Images []ImageConfig `json:"images"`
+	// InsecureRegistries are reached over plain HTTP, e.g. a local registry in a test cluster
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+	// TimeoutSeconds bounds the registry calls for one pod, keep it below the webhook timeout
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// CacheTTLSeconds is how long a successful verification of a digest is remembered
+	CacheTTLSeconds int `json:"cacheTTLSeconds,omitempty"`
+}
+
+// ImageConfig ties an image pattern to the keys its signatures must verify with
+type ImageConfig struct {
+	// Pattern is a registry/repository glob like in allowed-registries, ** crosses path segments
+	Pattern string `json:"pattern"`
+	// Keys are PEM public keys (cosign.pub); one valid signature from any of them is enough
+	Keys []string `json:"keys"`
+}
+
+// New builds the rule. rt is the HTTP transport used for registries, nil means the default.
+func New(cfg Config, rt http.RoundTripper) (admission.Rule, error) {
+	if len(cfg.Images) == 0 {
+		return nil, errors.New("images must not be empty")
+	}
+	if cfg.TimeoutSeconds < 0 || cfg.CacheTTLSeconds < 0 {
+		return nil, errors.New("timeoutSeconds and cacheTTLSeconds must not be negative")
+	}
+	v := &verifier{
+		insecure: cfg.InsecureRegistries,
+		timeout:  DefaultTimeout,
+		cacheTTL: DefaultCacheTTL,
+		options:  []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)},
+	}
+	if cfg.TimeoutSeconds > 0 {
+		v.timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	if cfg.CacheTTLSeconds > 0 {
+		v.cacheTTL = time.Duration(cfg.CacheTTLSeconds) * time.Second
+	}
+	if rt != nil {
+		v.options = append(v.options, remote.WithTransport(rt))
+	}
+
+	var errs []error
+	for i, img := range cfg.Images {
+		pattern, err := image.CompilePattern(img.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("images[%d]: %w", i, err))
+			continue
+		}
+		if len(img.Keys) == 0 {
+			errs = append(errs, fmt.Errorf("images[%d] %q: keys must not be empty", i, img.Pattern))
+			continue
+		}
+		policy := imagePolicy{pattern: pattern}
+		for j, pemKey := range img.Keys {
+			key, err := parsePublicKey([]byte(pemKey))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("images[%d] %q: keys[%d]: %w", i, img.Pattern, j, err))
+				continue
+			}
+			policy.keys = append(policy.keys, key)
+		}
+		policy.id = keysID(img.Keys)
+		v.policies = append(v.policies, policy)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return admission.NewRule(Name, admission.SeverityCritical, v.evaluate), nil
+}
+
+type imagePolicy struct {
+	pattern image.Pattern
+	keys    []publicKey
+	// id identifies the key set in the cache, a verification with other keys does not count
+	id string
+}
+
+type verifier struct {
+	policies []imagePolicy
+	insecure []string
+	timeout  time.Duration
+	cacheTTL time.Duration
+	options  []remote.Option
+}
+
+func (v *verifier) evaluate(pod *corev1.Pod) []admission.Violation {
+	// One deadline for the whole pod, the review has to answer within the webhook timeout
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	// Findings keep the container order; a verification is filled in once it is done
+	type finding struct {
+		container admission.ContainerRef
+		message   string
+		result    *error
+	}
+	var findings []finding
+	results := make(map[string]*error)
+	var wg sync.WaitGroup
+	for _, c := range admission.AllContainers(pod) {
+		ref, err := image.Parse(c.Container.Image)
+		if err != nil {
+			findings = append(findings, finding{container: c, message: err.Error()})
+			continue
+		}
+		for _, policy := range v.policies {
+			if !policy.pattern.Match(ref) {
+				continue
+			}
+			// The kubelet pulls the tag again later, by then it may point at an unsigned image
+			if ref.Digest == "" {
+				findings = append(findings, finding{container: c,
+					message: fmt.Sprintf("image %q must be pinned by digest (@sha256:...), a tag can be moved after its signature is checked", c.Container.Image)})
+				break
+			}
+			// The same image in several containers is verified once, different images in parallel
+			key := ref.Name() + "@" + ref.Digest + "\x00" + policy.id
+			result, started := results[key]
+			if !started {
+				result = new(error)
+				results[key] = result
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					*result = v.verify(ctx, ref, policy)
+				}()
+			}
+			findings = append(findings, finding{container: c, result: result})
+		}
+	}
+	wg.Wait()
+
+	var violations []admission.Violation
+	for _, f := range findings {
+		switch {
+		case f.message != "":
+			violations = append(violations, admission.Violationf("%s: %s", f.container, f.message))
+		case *f.result != nil:
+			violations = append(violations, admission.Violationf("%s: image %q: %v", f.container, f.container.Container.Image, *f.result))
+		}
+	}
+	return violations
+}
+
+// verify checks that one of the signatures of the pinned image verifies with a key of the policy
+func (v *verifier) verify(ctx context.Context, ref image.Reference, policy imagePolicy) error {
+	options := append(slices.Clone(v.options), remote.WithContext(ctx))
+
+	var nameOptions []name.Option
+	if slices.Contains(v.insecure, ref.Registry) {
+		nameOptions = append(nameOptions, name.Insecure)
+	}
+	repo, err := name.NewRepository(ref.Name(), nameOptions...)
+	if err != nil {
+		return fmt.Errorf("invalid repository: %w", err)
+	}
+
+	cacheKey := repo.String() + "@" + ref.Digest + "\x00" + policy.id
+	if verified.contains(cacheKey) {
+		return nil
+	}
+	signatures, err := fetchSignatures(repo, ref.Digest, options)
+	if err != nil {
+		return err
+	}
+	if err := verifySignatures(signatures, ref.Digest, policy.keys); err != nil {
+		return err
+	}
+	verified.add(cacheKey, v.cacheTTL)
+	return nil
+}
+
+// registryError shortens registry errors to what is useful in a denial message
+func registryError(err error) error {
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		if isNotFound(err) {
+			return errors.New("not found in the registry")
+		}
+		return fmt.Errorf("registry returned %d", terr.StatusCode)
+	}
+	return err
+}
+
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// keysID fingerprints a key set independently of the order of the keys
+func keysID(keys []string) string {
+	sorted := slices.Clone(keys)
+	for i := range sorted {
+		sorted[i] = strings.TrimSpace(sorted[i])
+	}
+	slices.Sort(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
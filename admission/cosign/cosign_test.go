@@ -0,0 +1,230 @@
+package cosign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"admission"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// testRegistry is an in-memory registry that counts the requests it serves
+type testRegistry struct {
+	host     string
+	requests atomic.Int64
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	r := &testRegistry{}
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.requests.Add(1)
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(srv.Close)
+	r.host = strings.TrimPrefix(srv.URL, "http://")
+	return r
+}
+
+// push uploads a random image and returns its reference pinned by digest
+func (r *testRegistry) push(t *testing.T, repository string) string {
+	t.Helper()
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(r.host+"/"+repository+":1.0", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("push %s: %v", ref, err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.host + "/" + repository + "@" + digest.String()
+}
+
+// sign stores a cosign signature by key over signedDigest next to the image pinned as image
+func (r *testRegistry) sign(t *testing.T, image, signedDigest string, key *ecdsa.PrivateKey) {
+	t.Helper()
+	repository, digest, _ := strings.Cut(image, "@")
+	payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":%q},"optional":null}`,
+		repository, signedDigest, payloadType)
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer([]byte(payload), "application/vnd.dev.cosign.simplesigning.v1+json"),
+		Annotations: map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	tag, err := name.NewTag(repository+":"+SignatureTag(digest), name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatalf("push signature %s: %v", tag, err)
+	}
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func evaluate(t *testing.T, rule admission.Rule, image string) []admission.Violation {
+	t.Helper()
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}}}
+	return rule.Evaluate(pod)
+}
+
+func TestVerify(t *testing.T) {
+	reg := newTestRegistry(t)
+	key, pub := newKey(t)
+	otherKey, _ := newKey(t)
+
+	signed := reg.push(t, "team/signed")
+	reg.sign(t, signed, digestOf(signed), key)
+
+	unsigned := reg.push(t, "team/unsigned")
+
+	wrongKey := reg.push(t, "team/wrong-key")
+	reg.sign(t, wrongKey, digestOf(wrongKey), otherKey)
+
+	// A valid signature of another image copied next to this one
+	replayed := reg.push(t, "team/replayed")
+	reg.sign(t, replayed, digestOf(signed), key)
+
+	rule, err := New(Config{
+		Images:             []ImageConfig{{Pattern: reg.host + "/team/**", Keys: []string{pub}}},
+		InsecureRegistries: []string{reg.host},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		image string
+		err   string
+	}{
+		{"signed", signed, ""},
+		{"unsigned", unsigned, "is not signed: no cosign signature found"},
+		{"signed with another key", wrongKey, "no signature verifies with the configured keys"},
+		{"signature over another digest", replayed, "signature is for " + digestOf(signed)},
+		{"tag only", reg.host + "/team/signed:1.0", "must be pinned by digest"},
+		{"not matched by the policy", reg.host + "/other/app:1.0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluate(t, rule, tt.image)
+			if tt.err == "" {
+				if len(got) > 0 {
+					t.Fatalf("got %v, want no violations", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.Contains(got[0].Message, tt.err) {
+				t.Fatalf("got %v, want a violation with %q", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyCachesSuccess(t *testing.T) {
+	reg := newTestRegistry(t)
+	key, pub := newKey(t)
+	signed := reg.push(t, "cache/app")
+	reg.sign(t, signed, digestOf(signed), key)
+	unsigned := reg.push(t, "cache/unsigned")
+
+	rule, err := New(Config{
+		Images:             []ImageConfig{{Pattern: reg.host + "/cache/*", Keys: []string{pub}}},
+		InsecureRegistries: []string{reg.host},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if got := evaluate(t, rule, signed); len(got) > 0 {
+		t.Fatalf("first verification: %v", got)
+	}
+	before := reg.requests.Load()
+	if got := evaluate(t, rule, signed); len(got) > 0 {
+		t.Fatalf("cached verification: %v", got)
+	}
+	if after := reg.requests.Load(); after != before {
+		t.Errorf("cache hit sent %d requests to the registry", after-before)
+	}
+
+	// Failures are not cached, the next pod asks the registry again
+	if got := evaluate(t, rule, unsigned); len(got) != 1 {
+		t.Fatalf("unsigned: %v", got)
+	}
+	before = reg.requests.Load()
+	if got := evaluate(t, rule, unsigned); len(got) != 1 {
+		t.Fatalf("unsigned: %v", got)
+	}
+	if reg.requests.Load() == before {
+		t.Error("a failed verification was served from the cache")
+	}
+
+	// Other keys for the same digest do not reuse the verification
+	_, otherPub := newKey(t)
+	other, err := New(Config{
+		Images:             []ImageConfig{{Pattern: reg.host + "/cache/*", Keys: []string{otherPub}}},
+		InsecureRegistries: []string{reg.host},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := evaluate(t, other, signed); len(got) != 1 {
+		t.Errorf("verified with keys that did not sign the image: %v", got)
+	}
+}
+
+func digestOf(image string) string {
+	_, digest, _ := strings.Cut(image, "@")
+	return digest
+}
@@ -0,0 +1,205 @@
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Cosign conventions for signatures stored in the registry
+const (
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	SignatureSuffix     = ".sig"
+	payloadType         = "cosign container image signature"
+	// maxPayload bounds a signature payload, real ones are a few hundred bytes
+	maxPayload = 64 << 10
+)
+
+// signature is one signature layer: the signed payload and the raw signature
+type signature struct {
+	payload   []byte
+	signature []byte
+}
+
+// payload is the simple signing document cosign signs
+type payload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// SignatureTag is the tag cosign stores the signatures of digest under: sha256-<hex>.sig
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + SignatureSuffix
+}
+
+// fetchSignatures reads every signature of digest from the repository
+func fetchSignatures(repo name.Repository, digest string, options []remote.Option) ([]signature, error) {
+	tag := repo.Tag(SignatureTag(digest))
+	img, err := remote.Image(tag, options...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, errors.New("is not signed: no cosign signature found")
+		}
+		return nil, fmt.Errorf("could not fetch signatures: %w", registryError(err))
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the signature manifest: %w", registryError(err))
+	}
+
+	var signatures []signature
+	for _, desc := range manifest.Layers {
+		encoded, ok := desc.Annotations[SignatureAnnotation]
+		if !ok {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("could not read a signature: %w", registryError(err))
+		}
+		// The payload is stored as is, Compressed returns the blob without decompressing it
+		blob, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("could not read a signature: %w", registryError(err))
+		}
+		data, err := io.ReadAll(io.LimitReader(blob, maxPayload))
+		blob.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read a signature: %w", registryError(err))
+		}
+		signatures = append(signatures, signature{payload: data, signature: raw})
+	}
+	if len(signatures) == 0 {
+		return nil, errors.New("is not signed: the signature image has no cosign signatures")
+	}
+	return signatures, nil
+}
+
+// verifySignatures succeeds when one signature is valid for one of the keys and signs digest
+func verifySignatures(signatures []signature, digest string, keys []publicKey) error {
+	var lastErr error
+	for _, sig := range signatures {
+		if !verifiesWithAny(sig, keys) {
+			lastErr = errors.New("no signature verifies with the configured keys")
+			continue
+		}
+		var p payload
+		if err := json.Unmarshal(sig.payload, &p); err != nil {
+			lastErr = fmt.Errorf("signed payload is not valid JSON: %w", err)
+			continue
+		}
+		if p.Critical.Type != payloadType {
+			lastErr = fmt.Errorf("signed payload has type %q, want %q", p.Critical.Type, payloadType)
+			continue
+		}
+		// A valid signature for another image must not be replayed for this one
+		if p.Critical.Image.DockerManifestDigest != digest {
+			lastErr = fmt.Errorf("signature is for %s, not for %s", p.Critical.Image.DockerManifestDigest, digest)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func verifiesWithAny(sig signature, keys []publicKey) bool {
+	for _, key := range keys {
+		if key.verify(sig.payload, sig.signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicKey is an ECDSA (cosign's default), RSA or Ed25519 key
+type publicKey struct {
+	key crypto.PublicKey
+}
+
+func parsePublicKey(data []byte) (publicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return publicKey{}, errors.New("no PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return publicKey{}, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return publicKey{key: key}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// verify checks sig over message like sigstore does: SHA-256 digests for ECDSA and
+// RSA PKCS#1 v1.5, the message itself for Ed25519
+func (k publicKey) verify(message, sig []byte) bool {
+	digest := sha256.Sum256(message)
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, sig)
+	default:
+		return false
+	}
+}
+
+// verified remembers successful verifications. It is shared by every rule instance,
+// so a policy reload does not throw away what was already verified.
+var verified = &cache{entries: make(map[string]time.Time)}
+
+// maxCacheEntries bounds the cache, it is cleared when full
+const maxCacheEntries = 10000
+
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func (c *cache) contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires, ok := c.entries[key]
+	if ok && time.Now().After(expires) {
+		delete(c.entries, key)
+		return false
+	}
+	return ok
+}
+
+func (c *cache) add(key string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCacheEntries {
+		clear(c.entries)
+	}
+	c.entries[key] = time.Now().Add(ttl)
+}
@@ -0,0 +1,112 @@
+package admission
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Annotations that ask for an exception. All three are required:
+//
+//	security.lab/exempt: no-privileged,no-host-access
+//	security.lab/exempt-justification: "CNI agent needs the host network"
+//	security.lab/exempt-until: "2026-12-31"
+//
+// Rules may be named with or without their "no-" prefix (privileged, host-access).
+// On workloads the annotations go on the pod template, so the pods inherit them.
+//
+// exempt and exempt-until may also be labels, so exempted pods can be listed with a label selector.
+// Label values allow no commas or colons: rules are separated by dots and the expiry is a plain date.
+// The justification is free text and always an annotation; an annotation wins over a label of the same key.
+const (
+	ExemptAnnotation              = "security.lab/exempt"
+	ExemptJustificationAnnotation = "security.lab/exempt-justification"
+	ExemptUntilAnnotation         = "security.lab/exempt-until"
+)
+
+// Exceptions says who may skip rules through the exempt annotations.
+// A nil *Exceptions grants nothing.
+type Exceptions struct {
+	// AllowedNamespaces are the only namespaces where exceptions are honoured
+	AllowedNamespaces []string `json:"allowedNamespaces"`
+	// MaxDays caps how far in the future exempt-until may be, 0 means no cap
+	MaxDays int `json:"maxDays,omitempty"`
+}
+
+// Exception is a parsed and validated set of exempt annotations
+type Exception struct {
+	Rules         []string
+	Justification string
+	Until         time.Time
+}
+
+// Covers reports whether the exception applies to the rule
+func (e *Exception) Covers(rule string) bool {
+	return slices.Contains(e.Rules, rule) || slices.Contains(e.Rules, strings.TrimPrefix(rule, "no-"))
+}
+
+// Grant returns the exception the pod asks for.
+// It returns nil, nil when the pod asks for none and an error when the request can not be honoured.
+func (e *Exceptions) Grant(pod *corev1.Pod, now time.Time) (*Exception, error) {
+	separator := ","
+	exempt, ok := pod.Annotations[ExemptAnnotation]
+	if !ok {
+		if exempt, ok = pod.Labels[ExemptAnnotation]; !ok {
+			return nil, nil
+		}
+		separator = "."
+	}
+	if e == nil || !slices.Contains(e.AllowedNamespaces, pod.Namespace) {
+		return nil, fmt.Errorf("exceptions are not allowed in namespace %q", pod.Namespace)
+	}
+
+	exception := &Exception{}
+	for _, rule := range strings.Split(exempt, separator) {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			exception.Rules = append(exception.Rules, rule)
+		}
+	}
+	if len(exception.Rules) == 0 {
+		return nil, fmt.Errorf("%s names no rules", ExemptAnnotation)
+	}
+
+	exception.Justification = strings.TrimSpace(pod.Annotations[ExemptJustificationAnnotation])
+	if exception.Justification == "" {
+		return nil, fmt.Errorf("%s is required", ExemptJustificationAnnotation)
+	}
+
+	expiry, ok := pod.Annotations[ExemptUntilAnnotation]
+	if !ok {
+		expiry = pod.Labels[ExemptUntilAnnotation]
+	}
+	until, err := parseExpiry(expiry)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(until) {
+		return nil, fmt.Errorf("exception expired at %s", until.Format(time.RFC3339))
+	}
+	if e.MaxDays > 0 && until.After(now.AddDate(0, 0, e.MaxDays)) {
+		return nil, fmt.Errorf("%s may be at most %d days ahead", ExemptUntilAnnotation, e.MaxDays)
+	}
+	exception.Until = until
+	return exception, nil
+}
+
+// parseExpiry accepts RFC 3339 or a plain date; a date is valid until the end of that day (UTC)
+func parseExpiry(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%s is required", ExemptUntilAnnotation)
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, fmt.Errorf("%s %q is neither a date (2006-01-02) nor RFC 3339", ExemptUntilAnnotation, value)
+}
@@ -0,0 +1,187 @@
+package admission
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGrant(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	exceptions := &Exceptions{AllowedNamespaces: []string{"kube-system"}, MaxDays: 90}
+	annotations := func(until string) map[string]string {
+		return map[string]string{
+			ExemptAnnotation:              "no-privileged, host-access",
+			ExemptJustificationAnnotation: "CNI agent",
+			ExemptUntilAnnotation:         until,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		annotations map[string]string
+		labels      map[string]string
+		rules       []string
+		until       time.Time
+		err         string
+	}{
+		{
+			name:      "no exception asked for",
+			namespace: "kube-system",
+		},
+		{
+			name:        "date is valid until the end of the day",
+			namespace:   "kube-system",
+			annotations: annotations("2026-06-30"),
+			rules:       []string{"no-privileged", "host-access"},
+			until:       time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "RFC 3339",
+			namespace:   "kube-system",
+			annotations: annotations("2026-06-01T18:00:00+02:00"),
+			rules:       []string{"no-privileged", "host-access"},
+			until:       time.Date(2026, 6, 1, 16, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "labels",
+			namespace: "kube-system",
+			annotations: map[string]string{
+				ExemptJustificationAnnotation: "CNI agent",
+			},
+			labels: map[string]string{
+				ExemptAnnotation:      "privileged.host-access",
+				ExemptUntilAnnotation: "2026-06-30",
+			},
+			rules: []string{"privileged", "host-access"},
+			until: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "annotation wins over label",
+			namespace:   "kube-system",
+			annotations: annotations("2026-06-30"),
+			labels:      map[string]string{ExemptAnnotation: "run-as-non-root", ExemptUntilAnnotation: "2020-01-01"},
+			rules:       []string{"no-privileged", "host-access"},
+			until:       time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "namespace not allowed",
+			namespace:   "default",
+			annotations: annotations("2026-06-30"),
+			err:         `not allowed in namespace "default"`,
+		},
+		{
+			name:        "no rules",
+			namespace:   "kube-system",
+			annotations: map[string]string{ExemptAnnotation: " , ", ExemptJustificationAnnotation: "x", ExemptUntilAnnotation: "2026-06-30"},
+			err:         "names no rules",
+		},
+		{
+			name:        "no justification",
+			namespace:   "kube-system",
+			annotations: map[string]string{ExemptAnnotation: "privileged", ExemptJustificationAnnotation: " ", ExemptUntilAnnotation: "2026-06-30"},
+			err:         ExemptJustificationAnnotation + " is required",
+		},
+		{
+			name:        "no expiry",
+			namespace:   "kube-system",
+			annotations: annotations(""),
+			err:         ExemptUntilAnnotation + " is required",
+		},
+		{
+			name:        "malformed date",
+			namespace:   "kube-system",
+			annotations: annotations("2026-13-01"),
+			err:         "is neither a date",
+		},
+		{
+			name:        "not a date at all",
+			namespace:   "kube-system",
+			annotations: annotations("next week"),
+			err:         "is neither a date",
+		},
+		{
+			name:        "day-first date",
+			namespace:   "kube-system",
+			annotations: annotations("30.06.2026"),
+			err:         "is neither a date",
+		},
+		{
+			name:        "expired yesterday",
+			namespace:   "kube-system",
+			annotations: annotations("2026-05-31"),
+			err:         "exception expired at 2026-06-01T00:00:00Z",
+		},
+		{
+			name:        "expires right now",
+			namespace:   "kube-system",
+			annotations: annotations("2026-06-01T12:00:00Z"),
+			err:         "exception expired",
+		},
+		{
+			name:        "beyond maxDays",
+			namespace:   "kube-system",
+			annotations: annotations("2026-12-31"),
+			err:         "at most 90 days ahead",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   tt.namespace,
+				Annotations: tt.annotations,
+				Labels:      tt.labels,
+			}}
+			exception, err := exceptions.Grant(pod, now)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Grant error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Grant: %v", err)
+			}
+			if tt.rules == nil {
+				if exception != nil {
+					t.Fatalf("Grant = %+v, want no exception", exception)
+				}
+				return
+			}
+			if !slices.Equal(exception.Rules, tt.rules) || !exception.Until.Equal(tt.until) {
+				t.Errorf("Grant = %v until %s, want %v until %s", exception.Rules, exception.Until, tt.rules, tt.until)
+			}
+		})
+	}
+}
+
+func TestGrantWithoutExceptionsPolicy(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "kube-system",
+		Annotations: map[string]string{ExemptAnnotation: "privileged"},
+	}}
+	var exceptions *Exceptions
+	if _, err := exceptions.Grant(pod, time.Now()); err == nil {
+		t.Fatal("a policy without exceptions granted one")
+	}
+}
+
+func TestExceptionCovers(t *testing.T) {
+	e := &Exception{Rules: []string{"privileged", "no-host-access"}}
+	for rule, want := range map[string]bool{
+		"no-privileged":  true,
+		"privileged":     true,
+		"no-host-access": true,
+		"host-access":    false,
+		"no-latest-tag":  false,
+	} {
+		if got := e.Covers(rule); got != want {
+			t.Errorf("Covers(%q) = %v, want %v", rule, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package admission
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FailurePolicy decides requests the webhook could not review: an object that can not be
+// decoded or a rule that failed. It is the webhook's own counterpart of failurePolicy in the
+// webhook configuration, which only covers the webhook not answering at all.
+type FailurePolicy string
+
+const (
+	// FailClosed rejects the request with the error
+	FailClosed FailurePolicy = "fail"
+	// FailOpen allows the request; the error is returned as a warning and an audit annotation
+	FailOpen FailurePolicy = "ignore"
+)
+
+// FailurePolicies lists every valid failure policy
+var FailurePolicies = []FailurePolicy{FailClosed, FailOpen}
+
+// ParseFailurePolicy validates a failure policy name, empty means fail
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	if s == "" {
+		return FailClosed, nil
+	}
+	for _, p := range FailurePolicies {
+		if FailurePolicy(s) == p {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown failure policy %q (supported: %v)", s, FailurePolicies)
+}
+
+// FailureAnnotation is the audit annotation a request allowed by FailOpen carries
+const FailureAnnotation = "review-error"
+
+// reviewFailed answers a request that could not be reviewed according to the failure policy.
+// code is the HTTP status of the error, e.g. 400 for an object that can not be decoded.
+func reviewFailed(name string, req *admissionv1.AdmissionRequest, policy FailurePolicy, code int32, err error) *admissionv1.AdmissionResponse {
+	if policy == FailOpen {
+		log.Printf("⚠️  [%s] %s: allowed by failure policy %s: %v", name, req.UID, policy, err)
+		response := &admissionv1.AdmissionResponse{
+			UID:      req.UID,
+			Allowed:  true,
+			Warnings: []string{fmt.Sprintf("%s could not review this request and allowed it: %v", name, err)},
+		}
+		addAuditAnnotation(response, FailureAnnotation, err.Error())
+		return response
+	}
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: false,
+		Result:  errorStatus(code, err.Error()),
+	}
+}
+
+// errorStatus is the Result of a rejected request, with the reason that belongs to code
+func errorStatus(code int32, message string) *metav1.Status {
+	reason := metav1.StatusReasonInternalError
+	switch code {
+	case http.StatusBadRequest:
+		reason = metav1.StatusReasonBadRequest
+	case http.StatusMethodNotAllowed:
+		reason = metav1.StatusReasonMethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		reason = metav1.StatusReasonRequestEntityTooLarge
+	}
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  reason,
+		Message: message,
+	}
+}
@@ -0,0 +1,230 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"admission/metrics"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Policy is everything the handler decides with.
+// It is replaced as a whole so a reload never mixes old rules with new exceptions.
+type Policy struct {
+	Rules []Rule
+	// ObjectRules run on every admitted object, with or without a pod spec
+	ObjectRules []ObjectRule
+	Exceptions  *Exceptions
+}
+
+// Handler is the /validate endpoint shared by all webhooks.
+// It decodes the AdmissionReview, runs the rules and encodes the AdmissionResponse.
+type Handler struct {
+	name       string
+	policy     atomic.Pointer[Policy]
+	namespaces NamespaceGetter
+	recorders  []Recorder
+	failure    FailurePolicy
+}
+
+// Recorder is told about every decision Review made, e.g. to keep PolicyReports up to date
+// or to record traffic for a replay. It is called from concurrent requests and must not block.
+type Recorder func(req *admissionv1.AdmissionRequest, decision *Decision, allowed bool)
+
+// NewHandler creates a handler; name is used in logs and denial messages
+func NewHandler(name string, rules ...Rule) *Handler {
+	h := &Handler{name: name, failure: FailClosed}
+	h.SetRules(rules...)
+	return h
+}
+
+// Policy returns the policy the handler currently evaluates
+func (h *Handler) Policy() *Policy {
+	return h.policy.Load()
+}
+
+// SetPolicy atomically replaces the policy.
+// Requests already being reviewed finish with the policy they started with.
+func (h *Handler) SetPolicy(p *Policy) {
+	h.policy.Store(p)
+}
+
+// Rules returns the rules the handler currently evaluates
+func (h *Handler) Rules() []Rule {
+	return h.Policy().Rules
+}
+
+// SetRules replaces the rules and drops any exceptions
+func (h *Handler) SetRules(rules ...Rule) {
+	h.SetPolicy(&Policy{Rules: rules})
+}
+
+// SetNamespaceGetter lets object rules see the namespace of the request.
+// It must be called before the handler starts serving.
+func (h *Handler) SetNamespaceGetter(namespaces NamespaceGetter) {
+	h.namespaces = namespaces
+}
+
+// SetFailurePolicy decides requests that can not be reviewed, FailClosed by default.
+// It must be called before the handler starts serving.
+func (h *Handler) SetFailurePolicy(policy FailurePolicy) {
+	h.failure = policy
+}
+
+// AddRecorder adds a Recorder. It must be called before the handler starts serving.
+func (h *Handler) AddRecorder(recorder Recorder) {
+	h.recorders = append(h.recorders, recorder)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveReview(w, r, h.name, "validate", h.failure, h.Review)
+}
+
+// Decision is the outcome of the policy for one request, before it is turned into a response
+type Decision struct {
+	// Object is "Kind namespace/name" for logs and messages
+	Object string
+	// Skipped is true when the object has no pod spec and there are no object rules
+	Skipped bool
+	// Violations are enforced with their action; Exempted were covered by Exception
+	Violations []Violation
+	Exempted   []Violation
+	Exception  *Exception
+	// ExceptionError says why an exception the object asked for was not honoured
+	ExceptionError error
+}
+
+// Decide runs the policy against a request. It is the engine behind Review and
+// is also used offline, by webhooklite check. It only fails when the object can not be decoded.
+func (h *Handler) Decide(req *admissionv1.AdmissionRequest) (*Decision, error) {
+	policy := h.Policy()
+	pod, err := podFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	decision := &Decision{Object: objectName(req, pod)}
+	if pod == nil && len(policy.ObjectRules) == 0 {
+		decision.Skipped = true
+		return decision, nil
+	}
+
+	var all []Violation
+	if pod != nil {
+		all = Evaluate(policy.Rules, pod)
+	}
+	all = append(all, EvaluateObjects(policy.ObjectRules, NewObjectRequest(context.Background(), req, h.namespaces))...)
+	if pod == nil {
+		decision.Violations = all
+		return decision, nil
+	}
+
+	decision.Exception, decision.ExceptionError = policy.Exceptions.Grant(pod, time.Now())
+	for _, v := range all {
+		if decision.Exception != nil && decision.Exception.Covers(v.Rule) {
+			decision.Exempted = append(decision.Exempted, v)
+		} else {
+			decision.Violations = append(decision.Violations, v)
+		}
+	}
+	return decision, nil
+}
+
+// Review builds the AdmissionResponse for a single request
+func (h *Handler) Review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	decision, err := h.Decide(req)
+	if err != nil {
+		log.Printf("❌ [%s] %s: %v", h.name, req.UID, err)
+		metrics.RecordDecodeError(h.name, "object")
+		return reviewFailed(h.name, req, h.failure, http.StatusBadRequest, err)
+	}
+	if decision.Skipped {
+		log.Printf("➖ [%s] %s: %s has no pod spec, nothing to check", h.name, req.UID, req.Kind.Kind)
+		h.record(req, decision, true)
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+
+	name := decision.Object
+	response := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	h.recordException(req, decision, response)
+
+	for _, v := range decision.Violations {
+		metrics.RecordViolation(h.name, v.Rule, string(v.Action), req.Namespace, string(req.Operation))
+	}
+	violations := ByAction(decision.Violations)
+
+	// warn: allowed, kubectl prints every warning to the user
+	for _, v := range violations[ActionWarn] {
+		response.Warnings = append(response.Warnings, v.String())
+	}
+	if len(response.Warnings) > 0 {
+		log.Printf("⚠️  [%s] %s: %s warned: %s", h.name, req.UID, name, strings.Join(response.Warnings, "; "))
+	}
+
+	// audit: allowed silently, recorded in our log and in the API server audit log
+	for _, v := range violations[ActionAudit] {
+		addAuditAnnotation(response, v.Rule, v.Message)
+		log.Printf("📝 [%s] %s: %s audit: %s", h.name, req.UID, name, v)
+	}
+
+	denied := violations[ActionDeny]
+	h.record(req, decision, len(denied) == 0)
+	if len(denied) == 0 {
+		log.Printf("✅ [%s] %s: %s allowed", h.name, req.UID, name)
+		return response
+	}
+
+	msgs := make([]string, 0, len(denied))
+	for _, v := range denied {
+		msgs = append(msgs, v.String())
+	}
+	log.Printf("🚫 [%s] %s: %s denied: %s", h.name, req.UID, name, strings.Join(msgs, "; "))
+
+	response.Allowed = false
+	response.Result = &metav1.Status{
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Message: fmt.Sprintf("%s denied %s: %s", h.name, name, strings.Join(msgs, "; ")),
+	}
+	return response
+}
+
+func (h *Handler) record(req *admissionv1.AdmissionRequest, decision *Decision, allowed bool) {
+	for _, recorder := range h.recorders {
+		recorder(req, decision, allowed)
+	}
+}
+
+// recordException leaves the audit trail of an exception: every use is logged with the
+// admission UID and the requesting user, an exception that can not be honoured is reported back as a warning
+func (h *Handler) recordException(req *admissionv1.AdmissionRequest, decision *Decision, response *admissionv1.AdmissionResponse) {
+	if err := decision.ExceptionError; err != nil {
+		log.Printf("🎫 [%s] %s: %s exception ignored (user %q): %v", h.name, req.UID, decision.Object, req.UserInfo.Username, err)
+		response.Warnings = append(response.Warnings, fmt.Sprintf("%s ignored: %v", ExemptAnnotation, err))
+		return
+	}
+	exception := decision.Exception
+	for _, v := range decision.Exempted {
+		until := exception.Until.Format(time.RFC3339)
+		log.Printf("🎫 [%s] %s: %s exception used for %s by user %q until %s (%s): %s",
+			h.name, req.UID, decision.Object, v.Rule, req.UserInfo.Username, until, exception.Justification, v.Message)
+		addAuditAnnotation(response, "exception-"+v.Rule, fmt.Sprintf("%s (until %s): %s", exception.Justification, until, v.Message))
+	}
+}
+
+// addAuditAnnotation appends to the audit annotation, a rule may report several violations
+func addAuditAnnotation(response *admissionv1.AdmissionResponse, key, value string) {
+	if response.AuditAnnotations == nil {
+		response.AuditAnnotations = make(map[string]string)
+	}
+	if prev, ok := response.AuditAnnotations[key]; ok {
+		value = prev + "; " + value
+	}
+	response.AuditAnnotations[key] = value
+}
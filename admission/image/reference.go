@@ -0,0 +1,134 @@
+// Package image parses container image references the way the container runtime does,
+// so rules compare fully qualified names instead of whatever the user typed.
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DockerHub is the registry of images without a registry part
+const DockerHub = "docker.io"
+
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// Reference is a normalised image reference: nginx:alpine is
+// Registry docker.io, Repository library/nginx, Tag alpine.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Parse normalises an image reference. Short names get docker.io and,
+// for single segment names, the library/ prefix.
+func Parse(image string) (Reference, error) {
+	var ref Reference
+	if image == "" {
+		return ref, fmt.Errorf("empty image reference")
+	}
+
+	name := image
+	if before, digest, found := strings.Cut(name, "@"); found {
+		if !digestPattern.MatchString(digest) {
+			return ref, fmt.Errorf("image %q: invalid digest %q", image, digest)
+		}
+		name, ref.Digest = before, digest
+	}
+
+	// The tag is after the last colon, but only if that colon is in the last path segment
+	// (registry ports like localhost:5000/app are not tags)
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if ref.Tag == "" {
+			return ref, fmt.Errorf("image %q: empty tag", image)
+		}
+	}
+
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, ref.Repository = first, rest
+	} else {
+		ref.Registry, ref.Repository = DockerHub, name
+	}
+	if ref.Registry == "index.docker.io" || ref.Registry == "registry-1.docker.io" {
+		ref.Registry = DockerHub
+	}
+	if ref.Registry == DockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Repository == "" || strings.HasPrefix(ref.Repository, "/") || strings.HasSuffix(ref.Repository, "/") {
+		return ref, fmt.Errorf("image %q: invalid repository", image)
+	}
+	if ref.Repository != strings.ToLower(ref.Repository) {
+		return ref, fmt.Errorf("image %q: repository must be lowercase", image)
+	}
+	return ref, nil
+}
+
+// Name is registry/repository without tag or digest
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// IsLatest reports whether the reference floats: no digest and no tag or the latest tag
+func (r Reference) IsLatest() bool {
+	return r.Digest == "" && (r.Tag == "" || r.Tag == "latest")
+}
+
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Pattern matches image names (registry/repository) against a glob:
+// * matches within one path segment, ** matches across segments.
+type Pattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// CompilePattern validates a glob like ghcr.io/cooler-sai/* or docker.io/library/**
+func CompilePattern(glob string) (Pattern, error) {
+	if glob == "" {
+		return Pattern{}, fmt.Errorf("empty pattern")
+	}
+	if strings.ContainsAny(glob, "@") {
+		return Pattern{}, fmt.Errorf("pattern %q must not contain a digest", glob)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return Pattern{glob: glob, re: regexp.MustCompile(b.String())}, nil
+}
+
+// Match reports whether the normalised name of the reference matches
+func (p Pattern) Match(ref Reference) bool {
+	return p.re.MatchString(ref.Name())
+}
+
+func (p Pattern) String() string {
+	return p.glob
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AuditCount is one line of a background audit: violations of rule with action found in namespace
+type AuditCount struct {
+	Namespace string
+	Rule      string
+	Action    string
+	Count     int
+}
+
+// RecordAudit replaces the result of the last background audit of webhook.
+// pods is the number of pods checked per namespace. The gauges describe the cluster as it is
+// now, so a scrape always sees one complete audit and never a mix of two.
+func RecordAudit(webhook string, pods map[string]int, violations []AuditCount, finished time.Time, took time.Duration) {
+	result := &auditResult{
+		pods:       make(map[string]int),
+		violations: make(map[auditKey]int),
+		finished:   finished,
+		took:       took,
+	}
+	for namespace, n := range pods {
+		result.pods[namespaceLabel(namespace)] += n
+	}
+	for _, v := range violations {
+		result.violations[auditKey{namespaceLabel(v.Namespace), v.Rule, v.Action}] += v.Count
+	}
+
+	audits.Lock()
+	audits.results[webhook] = result
+	audits.Unlock()
+}
+
+type auditKey struct{ namespace, rule, action string }
+
+type auditResult struct {
+	pods       map[string]int
+	violations map[auditKey]int
+	finished   time.Time
+	took       time.Duration
+}
+
+var audits = &auditCollector{results: make(map[string]*auditResult)}
+
+var (
+	auditPodsDesc = prometheus.NewDesc("admission_audit_pods",
+		"Running pods checked by the last background audit, by webhook and namespace.",
+		[]string{"webhook", "namespace"}, nil)
+	auditViolationsDesc = prometheus.NewDesc("admission_audit_violations",
+		"Violations of running pods found by the last background audit, by webhook, namespace, rule and action.",
+		[]string{"webhook", "namespace", "rule", "action"}, nil)
+	auditTimestampDesc = prometheus.NewDesc("admission_audit_last_run_timestamp_seconds",
+		"Unix time when the last background audit finished.",
+		[]string{"webhook"}, nil)
+	auditDurationDesc = prometheus.NewDesc("admission_audit_duration_seconds",
+		"How long the last background audit took.",
+		[]string{"webhook"}, nil)
+)
+
+// auditCollector serves the latest audit of every webhook
+type auditCollector struct {
+	sync.Mutex
+	results map[string]*auditResult
+}
+
+func (c *auditCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- auditPodsDesc
+	ch <- auditViolationsDesc
+	ch <- auditTimestampDesc
+	ch <- auditDurationDesc
+}
+
+func (c *auditCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+	for webhook, result := range c.results {
+		for namespace, n := range result.pods {
+			ch <- prometheus.MustNewConstMetric(auditPodsDesc, prometheus.GaugeValue, float64(n), webhook, namespace)
+		}
+		for key, n := range result.violations {
+			ch <- prometheus.MustNewConstMetric(auditViolationsDesc, prometheus.GaugeValue, float64(n), webhook, key.namespace, key.rule, key.action)
+		}
+		ch <- prometheus.MustNewConstMetric(auditTimestampDesc, prometheus.GaugeValue, float64(result.finished.Unix()), webhook)
+		ch <- prometheus.MustNewConstMetric(auditDurationDesc, prometheus.GaugeValue, result.took.Seconds(), webhook)
+	}
+}
@@ -0,0 +1,181 @@
+// Package metrics exposes the Prometheus metrics of the admission webhooks.
+// Labels only carry bounded values: webhook, rule and action names from the policy,
+// the admission operation and a capped set of namespaces. Object names never become labels.
+package metrics
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MaxNamespaces is how many distinct namespaces get their own label value,
+// the rest are counted under OtherNamespace
+var MaxNamespaces = 100
+
+const (
+	// OtherNamespace is the label of namespaces seen after MaxNamespaces was reached
+	OtherNamespace = "_other"
+	// ClusterScoped is the namespace label of cluster scoped objects
+	ClusterScoped = "_cluster"
+)
+
+// Registry holds every webhook metric plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "admission_requests_total",
+		Help: "Admission requests by webhook, endpoint, operation, namespace and whether they were allowed.",
+	}, []string{"webhook", "endpoint", "operation", "namespace", "allowed"})
+
+	decisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "admission_decisions_total",
+		Help: "Rule violations by webhook, rule, enforcement action, namespace and operation.",
+	}, []string{"webhook", "rule", "action", "namespace", "operation"})
+
+	duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "admission_review_duration_seconds",
+		Help:    "Time to answer an AdmissionReview, by webhook and endpoint.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"webhook", "endpoint"})
+
+	decodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "admission_decode_errors_total",
+		Help: "Requests that could not be decoded, by webhook and what failed (review or object).",
+	}, []string{"webhook", "stage"})
+
+	recordsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "admission_recording_dropped_total",
+		Help: "Admission requests that were not recorded because the recording queue was full, by webhook.",
+	}, []string{"webhook"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests, decisions, duration, decodeErrors, recordsDropped, audits,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Serve exposes /metrics over plain HTTP on its own port, away from the TLS admission port.
+// It only returns when the server fails.
+func Serve(port string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Printf("📊 Metrics on :%s/metrics", port)
+	return server.ListenAndServe()
+}
+
+// ObserveReview records how long an AdmissionReview took
+func ObserveReview(webhook, endpoint string, elapsed time.Duration) {
+	duration.WithLabelValues(webhook, endpoint).Observe(elapsed.Seconds())
+}
+
+// RecordRequest counts an answered admission request
+func RecordRequest(webhook, endpoint, operation, namespace string, allowed bool) {
+	requests.WithLabelValues(webhook, endpoint, operation, namespaceLabel(namespace), fmt.Sprint(allowed)).Inc()
+}
+
+// RecordViolation counts a rule violation with the action it got
+func RecordViolation(webhook, rule, action, namespace, operation string) {
+	decisions.WithLabelValues(webhook, rule, action, namespaceLabel(namespace), operation).Inc()
+}
+
+// RecordDecodeError counts a request that could not be decoded; stage is review or object
+func RecordDecodeError(webhook, stage string) {
+	decodeErrors.WithLabelValues(webhook, stage).Inc()
+}
+
+// RecordDroppedRecord counts a request that was answered but not recorded
+func RecordDroppedRecord(webhook string) {
+	recordsDropped.WithLabelValues(webhook).Inc()
+}
+
+// WatchCertificate exports the expiry of the serving certificate file as
+// admission_certificate_expiry_timestamp_seconds. The file is read on every scrape,
+// so a rotated certificate shows up without a restart.
+func WatchCertificate(webhook, certFile string) error {
+	if _, err := certificateExpiry(certFile); err != nil {
+		return err
+	}
+	return ObserveCertificate(webhook, func() (time.Time, error) {
+		return certificateExpiry(certFile)
+	})
+}
+
+// ObserveCertificate is WatchCertificate for certificates that do not live in a file
+func ObserveCertificate(webhook string, notAfter func() (time.Time, error)) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "admission_certificate_expiry_timestamp_seconds",
+		Help:        "Unix time when the serving certificate expires.",
+		ConstLabels: prometheus.Labels{"webhook": webhook},
+	}, func() float64 {
+		expiry, err := notAfter()
+		if err != nil {
+			log.Printf("⚠️  [%s] certificate expiry: %v", webhook, err)
+			return 0
+		}
+		return float64(expiry.Unix())
+	}))
+}
+
+// certificateExpiry returns NotAfter of the first certificate in a PEM file
+func certificateExpiry(certFile string) (time.Time, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, errors.New(certFile + ": no PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", certFile, err)
+	}
+	return cert.NotAfter, nil
+}
+
+var namespaces = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+// namespaceLabel caps the number of namespace label values at MaxNamespaces
+func namespaceLabel(namespace string) string {
+	if namespace == "" {
+		return ClusterScoped
+	}
+	namespaces.Lock()
+	defer namespaces.Unlock()
+	if namespaces.seen[namespace] {
+		return namespace
+	}
+	if len(namespaces.seen) >= MaxNamespaces {
+		return OtherNamespace
+	}
+	namespaces.seen[namespace] = true
+	return namespace
+}
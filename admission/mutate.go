@@ -0,0 +1,280 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MutationsAnnotation lists every change the mutating webhook made to a pod
+const MutationsAnnotation = "security.lab/mutations"
+
+// Defaults are the resource limits set on containers that have none
+type Defaults struct {
+	CPULimit    resource.Quantity
+	MemoryLimit resource.Quantity
+}
+
+// DefaultLimits - 500m CPU and 256Mi memory
+func DefaultLimits() Defaults {
+	return Defaults{
+		CPULimit:    resource.MustParse("500m"),
+		MemoryLimit: resource.MustParse("256Mi"),
+	}
+}
+
+// PatchOperation is a single RFC 6902 JSONPatch operation
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Mutator is the /mutate endpoint. It never rejects, it fills in safe defaults
+// so pods pass the validating rules instead of bouncing off them.
+type Mutator struct {
+	name       string
+	defaults   Defaults
+	failure    FailurePolicy
+	exceptions func() *Exceptions
+}
+
+func NewMutator(name string, defaults Defaults) *Mutator {
+	return &Mutator{name: name, defaults: defaults, failure: FailClosed}
+}
+
+// SetFailurePolicy decides pods that can not be decoded, FailClosed by default.
+// It must be called before the mutator starts serving.
+func (m *Mutator) SetFailurePolicy(policy FailurePolicy) {
+	m.failure = policy
+}
+
+// SetExceptions tells the mutator which exceptions the validator currently honours, so pods with
+// a valid exception keep running as root. It must be called before the mutator starts serving.
+func (m *Mutator) SetExceptions(exceptions func() *Exceptions) {
+	m.exceptions = exceptions
+}
+
+func (m *Mutator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveReview(w, r, m.name, "mutate", m.failure, m.Mutate)
+}
+
+// Mutate builds the patch response for a single request
+func (m *Mutator) Mutate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	// Almost all pod fields are immutable, defaults can only be set on creation.
+	// Workload templates are left alone, their pods get patched when they are created.
+	if req.Operation != admissionv1.Create || req.Kind.Group != "" || req.Kind.Kind != "Pod" {
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+
+	pod, done := decodeObject(m.name, req, m.failure)
+	if done != nil {
+		return done
+	}
+
+	var exception *Exception
+	if m.exceptions != nil {
+		exception, _ = m.exceptions().Grant(pod, time.Now())
+	}
+	patches, changes := Remediate(pod, m.defaults, exception)
+	if len(patches) == 0 {
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+	patches = append(patches, annotationPatch(pod, changes))
+
+	patch, err := json.Marshal(patches)
+	if err != nil {
+		log.Printf("❌ [%s] %s: could not encode patch: %v", m.name, req.UID, err)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Code:    http.StatusInternalServerError,
+				Reason:  metav1.StatusReasonInternalError,
+				Message: fmt.Sprintf("could not encode patch: %v", err),
+			},
+		}
+	}
+
+	log.Printf("🩹 [%s] %s: %s patched: %s", m.name, req.UID, objectName(req, pod), strings.Join(changes, "; "))
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		UID:       req.UID,
+		Allowed:   true,
+		Patch:     patch,
+		PatchType: &patchType,
+	}
+}
+
+// Remediate returns the patches that give the pod safe defaults and a readable description of each change.
+// Values that are already set are never overridden, even insecure ones: rejecting those is the validator's job.
+// Windows pods only get runAsNonRoot and limits, the API server rejects seccomp, allowPrivilegeEscalation and
+// capabilities on them. runAsNonRoot is left out for pods with an exception and for privileged or HostProcess
+// pods: CNI plugins and node agents run as root and would stop starting after their next restart.
+func Remediate(pod *corev1.Pod, defaults Defaults, exception *Exception) ([]PatchOperation, []string) {
+	var patches []PatchOperation
+	var changes []string
+	windows := pod.Spec.OS != nil && pod.Spec.OS.Name == corev1.Windows
+	mayRunAsRoot := exception != nil || runsPrivileged(pod)
+
+	// Pod level: runAsNonRoot and seccomp apply to every container that does not override them
+	podSC := &corev1.PodSecurityContext{}
+	if pod.Spec.SecurityContext != nil {
+		podSC = pod.Spec.SecurityContext.DeepCopy()
+	}
+	podChanged := false
+	if podSC.RunAsNonRoot == nil && !mayRunAsRoot {
+		podSC.RunAsNonRoot = ptr(true)
+		changes = append(changes, "spec.securityContext.runAsNonRoot=true")
+		podChanged = true
+	}
+	if podSC.SeccompProfile == nil && !windows {
+		podSC.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+		changes = append(changes, "spec.securityContext.seccompProfile=RuntimeDefault")
+		podChanged = true
+	}
+	if podChanged {
+		patches = append(patches, PatchOperation{Op: "add", Path: "/spec/securityContext", Value: podSC})
+	}
+
+	// Container level; ephemeral containers are added later through their own subresource
+	lists := []struct {
+		field      string
+		containers []corev1.Container
+	}{
+		{"initContainers", pod.Spec.InitContainers},
+		{"containers", pod.Spec.Containers},
+	}
+	for _, list := range lists {
+		for i := range list.containers {
+			c := &list.containers[i]
+			path := fmt.Sprintf("/spec/%s/%d", list.field, i)
+			field := fmt.Sprintf("spec.%s[%s]", list.field, c.Name)
+
+			if !windows {
+				if sc, scChanges := remediateSecurityContext(c); len(scChanges) > 0 {
+					patches = append(patches, PatchOperation{Op: "add", Path: path + "/securityContext", Value: sc})
+					for _, change := range scChanges {
+						changes = append(changes, field+"."+change)
+					}
+				}
+			}
+			if res, resChanges := remediateResources(c, defaults); len(resChanges) > 0 {
+				patches = append(patches, PatchOperation{Op: "add", Path: path + "/resources", Value: res})
+				for _, change := range resChanges {
+					changes = append(changes, field+"."+change)
+				}
+			}
+		}
+	}
+	return patches, changes
+}
+
+// runsPrivileged reports whether any container is privileged or a Windows HostProcess container,
+// hostProcess may be inherited from the pod
+func runsPrivileged(pod *corev1.Pod) bool {
+	podHostProcess := false
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil {
+		podHostProcess = *sc.WindowsOptions.HostProcess
+	}
+	for _, ref := range AllContainers(pod) {
+		sc := ref.Container.SecurityContext
+		if sc != nil && sc.Privileged != nil && *sc.Privileged {
+			return true
+		}
+		hostProcess := podHostProcess
+		if sc != nil && sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil {
+			hostProcess = *sc.WindowsOptions.HostProcess
+		}
+		if hostProcess {
+			return true
+		}
+	}
+	return false
+}
+
+func remediateSecurityContext(c *corev1.Container) (*corev1.SecurityContext, []string) {
+	sc := &corev1.SecurityContext{}
+	if c.SecurityContext != nil {
+		sc = c.SecurityContext.DeepCopy()
+	}
+
+	var changes []string
+	// The API server refuses allowPrivilegeEscalation=false together with privileged=true or CAP_SYS_ADMIN
+	privileged := sc.Privileged != nil && *sc.Privileged
+	sysAdmin := sc.Capabilities != nil &&
+		(slices.Contains(sc.Capabilities.Add, "SYS_ADMIN") || slices.Contains(sc.Capabilities.Add, "CAP_SYS_ADMIN"))
+	if sc.AllowPrivilegeEscalation == nil && !privileged && !sysAdmin {
+		sc.AllowPrivilegeEscalation = ptr(false)
+		changes = append(changes, "securityContext.allowPrivilegeEscalation=false")
+	}
+	if sc.Capabilities == nil {
+		sc.Capabilities = &corev1.Capabilities{}
+	}
+	if !slices.Contains(sc.Capabilities.Drop, "ALL") {
+		sc.Capabilities.Drop = append(sc.Capabilities.Drop, "ALL")
+		changes = append(changes, "securityContext.capabilities.drop+=ALL")
+	}
+	return sc, changes
+}
+
+func remediateResources(c *corev1.Container, defaults Defaults) (*corev1.ResourceRequirements, []string) {
+	res := c.Resources.DeepCopy()
+	if res.Limits == nil {
+		res.Limits = corev1.ResourceList{}
+	}
+
+	var changes []string
+	for name, def := range map[corev1.ResourceName]resource.Quantity{
+		corev1.ResourceCPU:    defaults.CPULimit,
+		corev1.ResourceMemory: defaults.MemoryLimit,
+	} {
+		if _, ok := res.Limits[name]; ok {
+			continue
+		}
+		// A limit below the request is invalid, so the request wins over the default
+		limit := def
+		if req, ok := res.Requests[name]; ok && req.Cmp(def) > 0 {
+			limit = req
+		}
+		res.Limits[name] = limit
+		changes = append(changes, fmt.Sprintf("resources.limits.%s=%s", name, limit.String()))
+	}
+	slices.Sort(changes)
+	return res, changes
+}
+
+// annotationPatch records the applied changes on the pod itself
+func annotationPatch(pod *corev1.Pod, changes []string) PatchOperation {
+	value, _ := json.Marshal(changes)
+	if pod.Annotations == nil {
+		return PatchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{MutationsAnnotation: string(value)},
+		}
+	}
+	return PatchOperation{
+		Op:    "add",
+		Path:  "/metadata/annotations/" + escapeJSONPointer(MutationsAnnotation),
+		Value: string(value),
+	}
+}
+
+// escapeJSONPointer escapes a key for use in a JSONPatch path (RFC 6901)
+func escapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
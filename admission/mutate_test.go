@@ -0,0 +1,110 @@
+package admission_test
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const runAsNonRootChange = "spec.securityContext.runAsNonRoot=true"
+
+func mutate(t *testing.T, m *admission.Mutator, pod string) []string {
+	t.Helper()
+	resp := m.Mutate(&admissionv1.AdmissionRequest{
+		UID:       "1",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Operation: admissionv1.Create,
+		Namespace: "kube-system",
+		Object:    runtime.RawExtension{Raw: []byte(pod)},
+	})
+	if !resp.Allowed {
+		t.Fatalf("mutator rejected the pod: %v", resp.Result)
+	}
+	var patches []admission.PatchOperation
+	if err := json.Unmarshal(resp.Patch, &patches); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	for _, p := range patches {
+		var value string
+		switch p.Path {
+		case "/metadata/annotations":
+			value, _ = p.Value.(map[string]any)[admission.MutationsAnnotation].(string)
+		case "/metadata/annotations/security.lab~1mutations":
+			value, _ = p.Value.(string)
+		default:
+			continue
+		}
+		var changes []string
+		if err := json.Unmarshal([]byte(value), &changes); err != nil {
+			t.Fatalf("%s: %v", admission.MutationsAnnotation, err)
+		}
+		return changes
+	}
+	t.Fatal("no mutations annotation in the patch")
+	return nil
+}
+
+func TestMutateRunAsNonRoot(t *testing.T) {
+	until := time.Now().AddDate(0, 0, 7).Format(time.DateOnly)
+	tests := []struct {
+		name    string
+		pod     string
+		nonRoot bool
+	}{
+		{
+			name:    "plain pod",
+			pod:     `{"metadata":{"name":"p"},"spec":{"containers":[{"name":"c","image":"nginx:1.27"}]}}`,
+			nonRoot: true,
+		},
+		{
+			name:    "privileged container",
+			pod:     `{"metadata":{"name":"p"},"spec":{"containers":[{"name":"c","image":"cni:1","securityContext":{"privileged":true}}]}}`,
+			nonRoot: false,
+		},
+		{
+			name: "HostProcess pod",
+			pod: `{"metadata":{"name":"p"},"spec":{"os":{"name":"windows"},"hostNetwork":true,` +
+				`"securityContext":{"windowsOptions":{"hostProcess":true}},"containers":[{"name":"c","image":"agent:1"}]}}`,
+			nonRoot: false,
+		},
+		{
+			name: "exempt pod",
+			pod: `{"metadata":{"name":"p","annotations":{"security.lab/exempt":"run-as-non-root",` +
+				`"security.lab/exempt-justification":"node agent","security.lab/exempt-until":"` + until + `"}},` +
+				`"spec":{"containers":[{"name":"c","image":"agent:1"}]}}`,
+			nonRoot: false,
+		},
+		{
+			name: "exception that is not honoured",
+			pod: `{"metadata":{"name":"p","annotations":{"security.lab/exempt":"run-as-non-root",` +
+				`"security.lab/exempt-justification":"node agent","security.lab/exempt-until":"2020-01-01"}},` +
+				`"spec":{"containers":[{"name":"c","image":"agent:1"}]}}`,
+			nonRoot: true,
+		},
+	}
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	m := admission.NewMutator("test", admission.DefaultLimits())
+	m.SetExceptions(func() *admission.Exceptions {
+		return &admission.Exceptions{AllowedNamespaces: []string{"kube-system"}}
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := mutate(t, m, tt.pod)
+			if got := slices.Contains(changes, runAsNonRootChange); got != tt.nonRoot {
+				t.Errorf("runAsNonRoot defaulted = %v, want %v (changes %v)", got, tt.nonRoot, changes)
+			}
+		})
+	}
+}
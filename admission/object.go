@@ -0,0 +1,185 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ObjectRule checks any admitted object, not only pods.
+// It sees the whole request: the old object, the user and the namespace.
+type ObjectRule interface {
+	Name() string
+	Severity() Severity
+	EvaluateObject(req *ObjectRequest) []Violation
+}
+
+// NamespaceGetter looks up a namespace for object rules that need it
+type NamespaceGetter func(ctx context.Context, name string) (*corev1.Namespace, error)
+
+// ObjectRequest is the admission request as object rules see it.
+// Objects are decoded lazily, once per request, into unstructured maps
+// (JSON numbers without a fraction become int64, like in Kubernetes).
+type ObjectRequest struct {
+	*admissionv1.AdmissionRequest
+
+	object          func() (map[string]any, error)
+	oldObject       func() (map[string]any, error)
+	namespaceObject func() (map[string]any, error)
+	pod             func() decodedPod
+}
+
+type decodedPod struct {
+	pod *corev1.Pod
+	ok  bool
+	err error
+}
+
+// NewObjectRequest wraps req; namespaces may be nil when no rule needs the namespace
+func NewObjectRequest(ctx context.Context, req *admissionv1.AdmissionRequest, namespaces NamespaceGetter) *ObjectRequest {
+	r := &ObjectRequest{AdmissionRequest: req}
+	r.object = sync.OnceValues(func() (map[string]any, error) {
+		return Unstructured(req.Object.Raw)
+	})
+	r.oldObject = sync.OnceValues(func() (map[string]any, error) {
+		return Unstructured(req.OldObject.Raw)
+	})
+	r.pod = sync.OnceValue(func() decodedPod {
+		pod, ok, err := PodFromObject(req.Kind, req.Object.Raw)
+		return decodedPod{pod: pod, ok: ok, err: err}
+	})
+	r.namespaceObject = sync.OnceValues(func() (map[string]any, error) {
+		if req.Namespace == "" {
+			return nil, nil
+		}
+		if namespaces == nil {
+			return nil, nil
+		}
+		ns, err := namespaces(ctx, req.Namespace)
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get namespace %q: %w", req.Namespace, err)
+		}
+		raw, err := json.Marshal(ns)
+		if err != nil {
+			return nil, err
+		}
+		return Unstructured(raw)
+	})
+	return r
+}
+
+// Object is the admitted object, nil on DELETE
+func (r *ObjectRequest) Object() (map[string]any, error) {
+	return r.object()
+}
+
+// OldObject is the object before the change, nil on CREATE
+func (r *ObjectRequest) OldObject() (map[string]any, error) {
+	return r.oldObject()
+}
+
+// NamespaceObject is the namespace the object lives in. It is nil for cluster scoped objects, and when the
+// namespace can not be found (offline checks, replays) or there is no getter, like the null namespaceObject
+// of a ValidatingAdmissionPolicy.
+func (r *ObjectRequest) NamespaceObject() (map[string]any, error) {
+	return r.namespaceObject()
+}
+
+// Pod is the pod, or the pod template of a workload, see PodFromObject. It is decoded once
+// per request and shared by the rules, which must not modify it. ok is false without a pod spec;
+// decoding errors are reported by the handler itself, rules can skip the object.
+func (r *ObjectRequest) Pod() (pod *corev1.Pod, ok bool, err error) {
+	if len(r.AdmissionRequest.Object.Raw) == 0 {
+		return nil, false, nil
+	}
+	decoded := r.pod()
+	return decoded.pod, decoded.ok, decoded.err
+}
+
+// NamespaceLabels are the labels of the request namespace. A namespace that can not be found
+// (offline checks) or looked up (no API access configured) only has kubernetes.io/metadata.name,
+// which the API server sets on every namespace. Cluster scoped objects have no labels.
+func (r *ObjectRequest) NamespaceLabels() (map[string]string, error) {
+	if r.Namespace == "" {
+		return map[string]string{}, nil
+	}
+	labels := map[string]string{corev1.LabelMetadataName: r.Namespace}
+	ns, err := r.NamespaceObject()
+	if err != nil {
+		return nil, err
+	}
+	metadata, _ := ns["metadata"].(map[string]any)
+	nsLabels, _ := metadata["labels"].(map[string]any)
+	for k, v := range nsLabels {
+		if s, ok := v.(string); ok {
+			labels[k] = s
+		}
+	}
+	return labels, nil
+}
+
+// EvaluateObjects runs all object rules against the request and collects every violation
+func EvaluateObjects(rules []ObjectRule, req *ObjectRequest) []Violation {
+	var violations []Violation
+	for _, rule := range rules {
+		for _, v := range rule.EvaluateObject(req) {
+			if v.Rule == "" {
+				v.Rule = rule.Name()
+			}
+			if v.Severity == "" {
+				v.Severity = rule.Severity()
+			}
+			if v.Action == "" {
+				v.Action = ActionOf(rule)
+			}
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// Unstructured decodes a JSON object into a map; empty input is a nil map
+func Unstructured(raw []byte) (map[string]any, error) {
+	if len(bytes.TrimSpace(raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("could not decode object: %w", err)
+	}
+	return convertNumbers(obj).(map[string]any), nil
+}
+
+func convertNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = convertNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
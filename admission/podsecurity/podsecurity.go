@@ -0,0 +1,149 @@
+// Package podsecurity enforces the Pod Security Standards (privileged, baseline, restricted)
+// the way the built-in PodSecurity admission does: the level comes from the
+// pod-security.kubernetes.io/{enforce,warn,audit}[-version] labels of the namespace and the
+// checks and messages are the upstream ones, so kubectl users see familiar wording.
+//
+// Unlike the built-in admission, the enforce level is also applied to workload pod templates,
+// like every other webhooklite rule.
+package podsecurity
+
+import (
+	"fmt"
+	"slices"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+)
+
+// Name reports violations of every Pod Security level under a single rule
+const Name = "pod-security"
+
+// Config is the podSecurity block of the policy file.
+//
+//	defaultLevel: baseline    # namespaces without an enforce label
+//	defaultVersion: latest
+//	exemptNamespaces: ["kube-system"]
+type Config struct {
+	DefaultLevel     string   `json:"defaultLevel,omitempty"`
+	DefaultVersion   string   `json:"defaultVersion,omitempty"`
+	ExemptNamespaces []string `json:"exemptNamespaces,omitempty"`
+}
+
+// New builds the rule. Unlabelled namespaces get the default level for all three modes,
+// privileged (allow everything) unless configured otherwise.
+func New(cfg Config) (admission.ObjectRule, error) {
+	defaults := api.LevelVersion{Level: api.LevelPrivileged, Version: api.LatestVersion()}
+	var err error
+	if cfg.DefaultLevel != "" {
+		if defaults.Level, err = api.ParseLevel(cfg.DefaultLevel); err != nil {
+			return nil, fmt.Errorf("defaultLevel: %w", err)
+		}
+	}
+	if cfg.DefaultVersion != "" {
+		if defaults.Version, err = api.ParseVersion(cfg.DefaultVersion); err != nil {
+			return nil, fmt.Errorf("defaultVersion: %w", err)
+		}
+	}
+	evaluator, err := policy.NewEvaluator(policy.DefaultChecks(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rule{
+		defaults:  api.Policy{Enforce: defaults, Audit: defaults, Warn: defaults},
+		exempt:    cfg.ExemptNamespaces,
+		evaluator: evaluator,
+	}, nil
+}
+
+type rule struct {
+	defaults  api.Policy
+	exempt    []string
+	evaluator policy.Evaluator
+}
+
+func (r *rule) Name() string                 { return Name }
+func (r *rule) Severity() admission.Severity { return admission.SeverityHigh }
+
+// EvaluateObject reports at most one violation per mode, like the PodSecurity admission:
+// enforce uses the action of the rule, warn and audit always warn and audit
+func (r *rule) EvaluateObject(req *admission.ObjectRequest) []admission.Violation {
+	if slices.Contains(r.exempt, req.Namespace) {
+		return nil
+	}
+	pod, ok, err := req.Pod()
+	if err != nil || !ok {
+		return nil
+	}
+	if req.Operation == admissionv1.Update && !specChanged(req, pod) {
+		return nil
+	}
+
+	nsPolicy, err := r.namespacePolicy(req)
+	if err != nil {
+		return []admission.Violation{admission.Violationf("could not determine the PodSecurity level of namespace %q: %v", req.Namespace, err)}
+	}
+
+	results := make(map[api.LevelVersion]policy.AggregateCheckResult)
+	evaluate := func(lv api.LevelVersion) policy.AggregateCheckResult {
+		if result, ok := results[lv]; ok {
+			return result
+		}
+		result := policy.AggregateCheckResults(r.evaluator.EvaluatePod(lv, &pod.ObjectMeta, &pod.Spec))
+		results[lv] = result
+		return result
+	}
+
+	var violations []admission.Violation
+	enforce := evaluate(nsPolicy.Enforce)
+	if !enforce.Allowed {
+		violations = append(violations, admission.Violationf("violates PodSecurity %q: %s", nsPolicy.Enforce.String(), enforce.ForbiddenDetail()))
+	}
+	if result := evaluate(nsPolicy.Audit); !result.Allowed {
+		violations = append(violations, admission.Violation{
+			Action:  admission.ActionAudit,
+			Message: fmt.Sprintf("would violate PodSecurity %q: %s", nsPolicy.Audit.String(), result.ForbiddenDetail()),
+		})
+	}
+	// No warning on top of a denial, the user already sees the reasons
+	if result := evaluate(nsPolicy.Warn); enforce.Allowed && !result.Allowed {
+		violations = append(violations, admission.Violation{
+			Action:  admission.ActionWarn,
+			Message: fmt.Sprintf("would violate PodSecurity %q: %s", nsPolicy.Warn.String(), result.ForbiddenDetail()),
+		})
+	}
+	return violations
+}
+
+// specChanged reports whether an UPDATE touches what the checks look at. Like upstream, updates that only
+// change metadata (relabelling, annotating) are allowed, otherwise existing non-compliant pods could not
+// even be relabelled. The PodSecurity annotations of a pod (AppArmor, seccomp) can not be changed after
+// creation; those of a workload template can, so templates compare their annotations too.
+func specChanged(req *admission.ObjectRequest, pod *corev1.Pod) bool {
+	if len(req.AdmissionRequest.OldObject.Raw) == 0 {
+		return true
+	}
+	old, ok, err := admission.PodFromObject(req.Kind, req.AdmissionRequest.OldObject.Raw)
+	if err != nil || !ok {
+		return true
+	}
+	if !apiequality.Semantic.DeepEqual(old.Spec, pod.Spec) {
+		return true
+	}
+	return req.Kind.Kind != "Pod" && !apiequality.Semantic.DeepEqual(old.Annotations, pod.Annotations)
+}
+
+// namespacePolicy resolves the namespace labels; a namespace without them gets the defaults
+func (r *rule) namespacePolicy(req *admission.ObjectRequest) (api.Policy, error) {
+	labels, err := req.NamespaceLabels()
+	if err != nil {
+		return api.Policy{}, err
+	}
+	// Like upstream, an invalid enforce label resolves to restricted:latest instead of failing open
+	nsPolicy, _ := api.PolicyToEvaluate(labels, r.defaults)
+	return nsPolicy, nil
+}
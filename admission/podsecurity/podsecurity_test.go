@@ -0,0 +1,179 @@
+package podsecurity
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// hostNetworkPod violates baseline, restrictedPod passes every level
+const (
+	hostNetworkPod = `{"metadata":{"name":"p","labels":{"app":"p"}},"spec":{"hostNetwork":true,"containers":[{"name":"c","image":"nginx"}]}}`
+	restrictedPod  = `{"metadata":{"name":"p"},"spec":{"securityContext":{"runAsNonRoot":true,"seccompProfile":{"type":"RuntimeDefault"}},` +
+		`"containers":[{"name":"c","image":"nginx","securityContext":{"allowPrivilegeEscalation":false,"capabilities":{"drop":["ALL"]}}}]}}`
+)
+
+func namespaces(labels map[string]map[string]string) admission.NamespaceGetter {
+	return func(_ context.Context, name string) (*corev1.Namespace, error) {
+		if name == "broken" {
+			return nil, errors.New("informer not synced")
+		}
+		l, ok := labels[name]
+		if !ok {
+			return nil, apierrors.NewNotFound(corev1.Resource("namespaces"), name)
+		}
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: l}}, nil
+	}
+}
+
+func podRequest(op admissionv1.Operation, namespace, object, oldObject string) *admissionv1.AdmissionRequest {
+	req := &admissionv1.AdmissionRequest{
+		UID:       "1",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Operation: op,
+		Namespace: namespace,
+		Object:    runtime.RawExtension{Raw: []byte(object)},
+	}
+	if oldObject != "" {
+		req.OldObject = runtime.RawExtension{Raw: []byte(oldObject)}
+	}
+	return req
+}
+
+// violation is the expected action and a part of the message
+type violation struct {
+	action  admission.Action
+	message string
+}
+
+func check(t *testing.T, got []admission.Violation, want []violation) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, v := range got {
+		if v.Action != want[i].action || !strings.Contains(v.Message, want[i].message) {
+			t.Errorf("violation %d = %s %q, want %s %q", i, v.Action, v.Message, want[i].action, want[i].message)
+		}
+	}
+}
+
+func TestLevelFromNamespaceLabels(t *testing.T) {
+	getter := namespaces(map[string]map[string]string{
+		"unlabelled": nil,
+		"baseline":   {label("enforce"): "baseline"},
+		"pinned":     {label("enforce"): "baseline", label("enforce-version"): "v1.24"},
+		"invalid":    {label("enforce"): "bogus"},
+		"warn":       {label("warn"): "baseline"},
+		"audit":      {label("audit"): "baseline", label("audit-version"): "v1.30"},
+		"all":        {label("enforce"): "baseline", label("warn"): "restricted", label("audit"): "restricted"},
+		"exempt":     {label("enforce"): "restricted"},
+	})
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		namespace string
+		pod       string
+		want      []violation
+	}{
+		{"unlabelled defaults to privileged", Config{}, "unlabelled", hostNetworkPod, nil},
+		{"unlabelled gets defaultLevel", Config{DefaultLevel: "baseline"}, "unlabelled", hostNetworkPod,
+			[]violation{{"", `violates PodSecurity "baseline:latest": host namespaces`}, {admission.ActionAudit, "baseline:latest"}}},
+		{"defaultVersion", Config{DefaultLevel: "baseline", DefaultVersion: "v1.25"}, "unlabelled", hostNetworkPod,
+			[]violation{{"", `"baseline:v1.25"`}, {admission.ActionAudit, `"baseline:v1.25"`}}},
+		{"missing namespace gets the defaults", Config{DefaultLevel: "baseline"}, "missing", hostNetworkPod,
+			[]violation{{"", `"baseline:latest"`}, {admission.ActionAudit, `"baseline:latest"`}}},
+		{"enforce label", Config{}, "baseline", hostNetworkPod,
+			[]violation{{"", `violates PodSecurity "baseline:latest"`}}},
+		{"enforce label allows a compliant pod", Config{}, "baseline", restrictedPod, nil},
+		{"enforce-version label", Config{}, "pinned", hostNetworkPod,
+			[]violation{{"", `violates PodSecurity "baseline:v1.24"`}}},
+		{"invalid label fails closed to restricted", Config{}, "invalid", hostNetworkPod,
+			[]violation{{"", `violates PodSecurity "restricted:latest"`}}},
+		{"warn label", Config{}, "warn", hostNetworkPod,
+			[]violation{{admission.ActionWarn, `would violate PodSecurity "baseline:latest"`}}},
+		{"audit label with version", Config{}, "audit", hostNetworkPod,
+			[]violation{{admission.ActionAudit, `would violate PodSecurity "baseline:v1.30"`}}},
+		{"no warning on top of a denial", Config{}, "all", hostNetworkPod,
+			[]violation{{"", `"baseline:latest"`}, {admission.ActionAudit, `"restricted:latest"`}}},
+		{"exempt namespace", Config{ExemptNamespaces: []string{"exempt"}}, "exempt", hostNetworkPod, nil},
+		{"namespace lookup error", Config{}, "broken", hostNetworkPod,
+			[]violation{{"", `could not determine the PodSecurity level of namespace "broken"`}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			req := admission.NewObjectRequest(context.Background(), podRequest(admissionv1.Create, tt.namespace, tt.pod, ""), getter)
+			check(t, rule.EvaluateObject(req), tt.want)
+		})
+	}
+}
+
+func TestNewRejectsInvalidDefaults(t *testing.T) {
+	if _, err := New(Config{DefaultLevel: "strict"}); err == nil || !strings.Contains(err.Error(), "defaultLevel") {
+		t.Errorf("defaultLevel strict: %v", err)
+	}
+	if _, err := New(Config{DefaultVersion: "1.30"}); err == nil || !strings.Contains(err.Error(), "defaultVersion") {
+		t.Errorf("defaultVersion 1.30: %v", err)
+	}
+}
+
+// Regression test: UPDATEs that only touch metadata must not be denied, otherwise a
+// non-compliant pod admitted before the namespace was labelled could not even be relabelled
+func TestUpdateSkipsUnchangedSpec(t *testing.T) {
+	getter := namespaces(map[string]map[string]string{"baseline": {label("enforce"): "baseline"}})
+	rule, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relabelled := strings.Replace(hostNetworkPod, `"app":"p"`, `"app":"p","tier":"web"`, 1)
+	newImage := strings.Replace(hostNetworkPod, `"image":"nginx"`, `"image":"nginx:1.27"`, 1)
+
+	deployment := func(annotations string) string {
+		return `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"d"},"spec":{"template":{"metadata":{"annotations":{` +
+			annotations + `}},"spec":{"hostNetwork":true,"containers":[{"name":"c","image":"nginx"}]}}}}`
+	}
+	deploymentRequest := func(object, oldObject string) *admissionv1.AdmissionRequest {
+		req := podRequest(admissionv1.Update, "baseline", object, oldObject)
+		req.Kind = metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     *admissionv1.AdmissionRequest
+		checked bool
+	}{
+		{"pod labels only", podRequest(admissionv1.Update, "baseline", relabelled, hostNetworkPod), false},
+		{"pod spec", podRequest(admissionv1.Update, "baseline", newImage, hostNetworkPod), true},
+		{"pod without old object", podRequest(admissionv1.Update, "baseline", relabelled, ""), true},
+		{"pod create", podRequest(admissionv1.Create, "baseline", hostNetworkPod, ""), true},
+		{"template unchanged", deploymentRequest(deployment(`"a":"1"`), deployment(`"a":"1"`)), false},
+		{"template annotations", deploymentRequest(deployment(`"a":"2"`), deployment(`"a":"1"`)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.EvaluateObject(admission.NewObjectRequest(context.Background(), tt.req, getter))
+			if checked := len(got) > 0; checked != tt.checked {
+				t.Errorf("checked = %v (%v), want %v", checked, got, tt.checked)
+			}
+		})
+	}
+}
+
+func label(mode string) string {
+	return "pod-security.kubernetes.io/" + mode
+}
@@ -0,0 +1,64 @@
+package admission
+
+import (
+	"fmt"
+)
+
+// Registry keeps rules by name so binaries and policy files can refer to them.
+// It is meant to be filled at startup and only read afterwards.
+type Registry struct {
+	rules map[string]Rule
+	order []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{rules: make(map[string]Rule)}
+}
+
+// Register adds rules to the registry, names must be unique
+func (r *Registry) Register(rules ...Rule) error {
+	for _, rule := range rules {
+		if _, exists := r.rules[rule.Name()]; exists {
+			return fmt.Errorf("rule %q is already registered", rule.Name())
+		}
+		r.rules[rule.Name()] = rule
+		r.order = append(r.order, rule.Name())
+	}
+	return nil
+}
+
+// MustRegister is Register for package level setup, it panics on duplicates
+func (r *Registry) MustRegister(rules ...Rule) {
+	if err := r.Register(rules...); err != nil {
+		panic(err)
+	}
+}
+
+func (r *Registry) Lookup(name string) (Rule, bool) {
+	rule, ok := r.rules[name]
+	return rule, ok
+}
+
+// Select returns the named rules in the given order
+func (r *Registry) Select(names ...string) ([]Rule, error) {
+	selected := make([]Rule, 0, len(names))
+	for _, name := range names {
+		rule, ok := r.rules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rule %q (known: %v)", name, r.order)
+		}
+		selected = append(selected, rule)
+	}
+	return selected, nil
+}
+
+// Names returns all registered rule names in registration order
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.order...)
+}
+
+// Rules returns all registered rules in registration order
+func (r *Registry) Rules() []Rule {
+	rules, _ := r.Select(r.order...)
+	return rules
+}
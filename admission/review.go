@@ -0,0 +1,184 @@
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"admission/metrics"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Versions of AdmissionReview the webhooks accept. v1beta1 has the same schema as v1, so both
+// decode into the v1 types; the response goes back in the version of the request.
+var (
+	ReviewV1       = admissionv1.SchemeGroupVersion.String()
+	ReviewV1beta1  = admissionv1beta1.SchemeGroupVersion.String()
+	ReviewVersions = []string{ReviewV1, ReviewV1beta1}
+)
+
+// MaxReviewBytes bounds the AdmissionReview body. The API server limits an object to about 3MB
+// and an UPDATE carries two of them.
+var MaxReviewBytes int64 = 8 << 20
+
+// serveReview decodes the AdmissionReview, lets review decide and writes the answer back.
+// It is shared by the validating and the mutating endpoints; endpoint is only used as a metric label.
+// Malformed reviews are answered with an AdmissionReview whose Result carries the HTTP status,
+// a review that panics is decided by failure like an object that can not be decoded.
+func serveReview(w http.ResponseWriter, r *http.Request, name, endpoint string, failure FailurePolicy, review func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
+	start := time.Now()
+	defer func() { metrics.ObserveReview(name, endpoint, time.Since(start)) }()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		rejectReview(w, name, ReviewV1, http.StatusMethodNotAllowed, "AdmissionReviews must be POSTed")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxReviewBytes))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		rejectReview(w, name, ReviewV1, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+		return
+	case err != nil:
+		rejectReview(w, name, ReviewV1, http.StatusBadRequest, fmt.Sprintf("could not read request body: %v", err))
+		return
+	case len(body) == 0:
+		rejectReview(w, name, ReviewV1, http.StatusBadRequest, "empty request body")
+		return
+	}
+
+	var ar admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &ar); err != nil {
+		rejectReview(w, name, ReviewV1, http.StatusBadRequest, fmt.Sprintf("could not parse AdmissionReview: %v", err))
+		return
+	}
+	version, err := reviewVersion(ar.TypeMeta)
+	if err != nil {
+		rejectReview(w, name, ReviewV1, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ar.Request == nil {
+		rejectReview(w, name, version, http.StatusBadRequest, "AdmissionReview has no request")
+		return
+	}
+
+	response := safeReview(name, ar.Request, failure, review)
+	metrics.RecordRequest(name, endpoint, string(ar.Request.Operation), ar.Request.Namespace, response.Allowed)
+	writeReview(w, name, version, http.StatusOK, response)
+}
+
+// reviewVersion returns the apiVersion to answer in. An AdmissionReview without TypeMeta,
+// e.g. one written by hand for curl, is answered in v1.
+func reviewVersion(meta metav1.TypeMeta) (string, error) {
+	if meta.Kind != "" && meta.Kind != "AdmissionReview" {
+		return "", fmt.Errorf("expected an AdmissionReview, got %s", meta.Kind)
+	}
+	if meta.APIVersion == "" {
+		return ReviewV1, nil
+	}
+	if !slices.Contains(ReviewVersions, meta.APIVersion) {
+		return "", fmt.Errorf("unsupported AdmissionReview version %q (supported: %v)", meta.APIVersion, ReviewVersions)
+	}
+	return meta.APIVersion, nil
+}
+
+// safeReview runs review and turns a panic, e.g. a rule tripping over an unexpected object,
+// into an error response instead of a dropped connection
+func safeReview(name string, req *admissionv1.AdmissionRequest, failure FailurePolicy, review func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) (response *admissionv1.AdmissionResponse) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("💥 [%s] %s: review panicked: %v\n%s", name, req.UID, p, debug.Stack())
+			response = reviewFailed(name, req, failure, http.StatusInternalServerError, fmt.Errorf("internal error: %v", p))
+		}
+	}()
+	return review(req)
+}
+
+// rejectReview answers a request that is not a usable AdmissionReview
+func rejectReview(w http.ResponseWriter, name, version string, code int32, message string) {
+	log.Printf("❌ [%s] %s", name, message)
+	metrics.RecordDecodeError(name, "review")
+	writeReview(w, name, version, int(code), &admissionv1.AdmissionResponse{Allowed: false, Result: errorStatus(code, message)})
+}
+
+// writeReview wraps the response in an AdmissionReview of version and writes it with the HTTP status
+func writeReview(w http.ResponseWriter, name, version string, status int, response *admissionv1.AdmissionResponse) {
+	responseReview := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: version,
+			Kind:       "AdmissionReview",
+		},
+		Response: response,
+	}
+
+	res, err := json.Marshal(responseReview)
+	if err != nil {
+		log.Printf("❌ [%s] Could not encode response: %v", name, err)
+		http.Error(w, "could not encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(res); err != nil {
+		log.Printf("❌ [%s] Could not write response: %v", name, err)
+	}
+}
+
+// decodeObject reads the pod, or the pod template of a workload, out of the request.
+// When there is nothing to check or decoding fails it returns the response to send back instead.
+func decodeObject(name string, req *admissionv1.AdmissionRequest, failure FailurePolicy) (*corev1.Pod, *admissionv1.AdmissionResponse) {
+	pod, err := podFromRequest(req)
+	if err != nil {
+		log.Printf("❌ [%s] %s: %v", name, req.UID, err)
+		metrics.RecordDecodeError(name, "object")
+		return nil, reviewFailed(name, req, failure, http.StatusBadRequest, err)
+	}
+	if pod == nil {
+		log.Printf("➖ [%s] %s: %s has no pod spec, nothing to check", name, req.UID, req.Kind.Kind)
+		return nil, &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+	return pod, nil
+}
+
+// podFromRequest decodes the pod or pod template of the object, nil when it has none
+func podFromRequest(req *admissionv1.AdmissionRequest) (*corev1.Pod, error) {
+	if len(req.Object.Raw) == 0 {
+		// DELETE carries only the old object
+		return nil, nil
+	}
+	pod, ok, err := PodFromObject(req.Kind, req.Object.Raw)
+	if err != nil || !ok {
+		return nil, err
+	}
+	// The namespace is not always set on the object itself during CREATE
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+	return pod, nil
+}
+
+// objectName is "Kind namespace/name" for logs and messages.
+// Pods created by controllers only have a generateName; pod is nil for objects without a pod spec.
+func objectName(req *admissionv1.AdmissionRequest, pod *corev1.Pod) string {
+	name := req.Name
+	if name == "" && pod != nil {
+		name = pod.Name
+		if name == "" {
+			name = pod.GenerateName + "*"
+		}
+	}
+	return fmt.Sprintf("%s %s/%s", req.Kind.Kind, req.Namespace, name)
+}
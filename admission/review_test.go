@@ -0,0 +1,128 @@
+package admission_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"admission"
+	"admission/rules"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const seedPod = `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"p","namespace":"default"},` +
+	`"spec":{"securityContext":{"runAsNonRoot":true},"containers":[{"name":"c","image":"nginx:1.27",` +
+	`"securityContext":{"privileged":true},"resources":{"limits":{"cpu":"1","memory":"1Gi"}}}]}}`
+
+const seedDeployment = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"d","namespace":"default"},` +
+	`"spec":{"template":{"metadata":{"labels":{"app":"d"}},"spec":{"containers":[{"name":"c","image":"nginx"}]}}}}`
+
+func seedReview(apiVersion, kind, object string) string {
+	return `{"apiVersion":"` + apiVersion + `","kind":"AdmissionReview","request":{"uid":"42",` +
+		`"kind":{"group":"","version":"v1","kind":"` + kind + `"},"operation":"CREATE","namespace":"default",` +
+		`"object":` + object + `}}`
+}
+
+// FuzzServeReview sends arbitrary bodies to /validate and /mutate. Every answer must be a
+// non-200 status or a well-formed AdmissionReview answering the UID of the request.
+func FuzzServeReview(f *testing.F) {
+	for _, seed := range []string{
+		seedReview("admission.k8s.io/v1", "Pod", seedPod),
+		seedReview("admission.k8s.io/v1beta1", "Pod", seedPod),
+		seedReview("admission.k8s.io/v1", "Deployment", seedDeployment),
+		seedReview("admission.k8s.io/v1", "Pod", `{"spec":{"containers":"nope"}}`),
+		seedReview("admission.k8s.io/v1", "Pod", `null`),
+		seedReview("admission.k8s.io/v2", "Pod", seedPod),
+		`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`,
+		`{"kind":"Pod"}`,
+		`{"request":{"uid":"1","kind":{"kind":"Pod"},"object":{"spec":{"initContainers":[{}],"ephemeralContainers":[{}]}}}}`,
+		`[]`,
+		`{`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(nil) })
+	validator := admission.NewHandler("fuzz", rules.Builtin().Rules()...)
+	mutator := admission.NewMutator("fuzz", admission.DefaultLimits())
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var sent admissionv1.AdmissionReview
+		_ = json.Unmarshal(body, &sent)
+
+		for _, endpoint := range []http.Handler{validator, mutator} {
+			rec := httptest.NewRecorder()
+			endpoint.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				continue
+			}
+
+			var got admissionv1.AdmissionReview
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("200 with a body that is not an AdmissionReview: %v\n%s", err, rec.Body)
+			}
+			if got.Kind != "AdmissionReview" || !slices.Contains(admission.ReviewVersions, got.APIVersion) {
+				t.Fatalf("200 with TypeMeta %+v", got.TypeMeta)
+			}
+			if got.Response == nil {
+				t.Fatal("200 without a response")
+			}
+			if sent.Request == nil || got.Response.UID != sent.Request.UID {
+				t.Fatalf("response UID %q does not answer the request", got.Response.UID)
+			}
+			if got.Response.Patch != nil && !json.Valid(got.Response.Patch) {
+				t.Fatalf("patch is not JSON: %s", got.Response.Patch)
+			}
+		}
+	})
+}
+
+// FuzzPodFromObject decodes arbitrary objects as every workload kind
+func FuzzPodFromObject(f *testing.F) {
+	for _, seed := range []string{
+		seedPod,
+		seedDeployment,
+		`{"spec":{"jobTemplate":{"spec":{"template":{"spec":{"containers":[{"name":"c"}]}}}}}}`,
+		`{"spec":{"template":null}}`,
+		`{"metadata":{"namespace":1}}`,
+		`null`,
+		``,
+	} {
+		for i := range admission.WorkloadKinds {
+			f.Add(uint8(i), []byte(seed))
+		}
+	}
+	// A kind without a pod spec
+	f.Add(uint8(len(admission.WorkloadKinds)), []byte(seedPod))
+
+	f.Fuzz(func(t *testing.T, kindIndex uint8, raw []byte) {
+		kind := metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+		if int(kindIndex) < len(admission.WorkloadKinds) {
+			group, k, _ := bytes.Cut([]byte(admission.WorkloadKinds[kindIndex]), []byte("/"))
+			kind = metav1.GroupVersionKind{Group: string(group), Version: "v1", Kind: string(k)}
+		}
+
+		pod, ok, err := admission.PodFromObject(kind, raw)
+		switch {
+		case !ok && (pod != nil || err != nil):
+			t.Fatalf("%s without a pod spec returned pod=%v err=%v", kind.Kind, pod, err)
+		case ok && err == nil && pod == nil:
+			t.Fatalf("%s decoded without error but no pod", kind.Kind)
+		case ok && err != nil && pod != nil:
+			t.Fatalf("%s returned a pod together with %v", kind.Kind, err)
+		}
+		if pod != nil {
+			// The containers of whatever was decoded must be walkable by the rules
+			admission.AllContainers(pod)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Package admission is the shared admission webhook library used by sac, sentinel and webhooklite.
+// A binary picks the rules it wants and hands them to NewHandler.
+package admission
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Severity says how bad a violation is
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// Severities lists every valid severity, lowest first
+var Severities = []Severity{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// ParseSeverity validates a severity name, empty means fallback
+func ParseSeverity(s string, fallback Severity) (Severity, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	for _, severity := range Severities {
+		if Severity(s) == severity {
+			return severity, nil
+		}
+	}
+	return "", fmt.Errorf("unknown severity %q (supported: %v)", s, Severities)
+}
+
+// Violation is a single problem found by a rule
+type Violation struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Action   Action   `json:"action"`
+	Message  string   `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+}
+
+// Rule checks a pod and reports every problem it finds, not just the first one
+type Rule interface {
+	Name() string
+	Severity() Severity
+	Evaluate(pod *corev1.Pod) []Violation
+}
+
+// NewRule turns a plain function into a Rule.
+// The function only has to fill in Message; Rule and Severity are set by Evaluate.
+func NewRule(name string, severity Severity, eval func(pod *corev1.Pod) []Violation) Rule {
+	return &funcRule{name: name, severity: severity, eval: eval}
+}
+
+type funcRule struct {
+	name     string
+	severity Severity
+	eval     func(pod *corev1.Pod) []Violation
+}
+
+func (r *funcRule) Name() string       { return r.name }
+func (r *funcRule) Severity() Severity { return r.severity }
+
+func (r *funcRule) Evaluate(pod *corev1.Pod) []Violation {
+	return r.eval(pod)
+}
+
+// Evaluate runs all rules against the pod and collects every violation
+func Evaluate(rules []Rule, pod *corev1.Pod) []Violation {
+	var violations []Violation
+	for _, rule := range rules {
+		for _, v := range rule.Evaluate(pod) {
+			if v.Rule == "" {
+				v.Rule = rule.Name()
+			}
+			if v.Severity == "" {
+				v.Severity = rule.Severity()
+			}
+			if v.Action == "" {
+				v.Action = ActionOf(rule)
+			}
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// ByAction splits violations by their enforcement action
+func ByAction(violations []Violation) map[Action][]Violation {
+	split := make(map[Action][]Violation)
+	for _, v := range violations {
+		split[v.Action] = append(split[v.Action], v)
+	}
+	return split
+}
+
+// Violationf is a shortcut for rules building a violation message
+func Violationf(format string, args ...any) Violation {
+	return Violation{Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultAllowedCapabilities - the only capability the restricted Pod Security Standard lets containers add
+var DefaultAllowedCapabilities = []string{"NET_BIND_SERVICE"}
+
+// capabilityAll drops or adds every capability
+const capabilityAll = "ALL"
+
+var capabilityName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// CapabilitiesParams - policy params of the allowed-capabilities rule.
+//
+//	allowed: ["NET_BIND_SERVICE"]                       # any container may add these
+//	grants:                                             # extra capabilities for some pods
+//	  - namespaces: ["monitoring"]
+//	    serviceAccounts: ["kube-system/cilium"]         # namespace/name
+//	    capabilities: ["NET_ADMIN", "SYS_TIME"]
+type CapabilitiesParams struct {
+	// Allowed defaults to DefaultAllowedCapabilities, an empty list allows nothing
+	Allowed []string          `json:"allowed"`
+	Grants  []CapabilityGrant `json:"grants,omitempty"`
+}
+
+// CapabilityGrant allows extra capabilities to pods in one of the namespaces or running as one
+// of the service accounts
+type CapabilityGrant struct {
+	Namespaces      []string `json:"namespaces,omitempty"`
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+func capabilitiesFactory(params json.RawMessage) (admission.Rule, error) {
+	p := CapabilitiesParams{}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Allowed == nil {
+		p.Allowed = slices.Clone(DefaultAllowedCapabilities)
+	}
+	return Capabilities(p)
+}
+
+// Capabilities requires every container to drop ALL capabilities and only lets it add the allowed ones,
+// plus those granted to the namespace or service account of the pod.
+// Capability names are compared without the CAP_ prefix and case, like container runtimes do.
+// Windows pods have no capabilities and are skipped.
+func Capabilities(p CapabilitiesParams) (admission.Rule, error) {
+	allowed, err := normalizeCapabilities(p.Allowed)
+	if err != nil {
+		return nil, fmt.Errorf("allowed: %w", err)
+	}
+	grants := make([]CapabilityGrant, 0, len(p.Grants))
+	for i, g := range p.Grants {
+		if len(g.Namespaces) == 0 && len(g.ServiceAccounts) == 0 {
+			return nil, fmt.Errorf("grants[%d]: namespaces or serviceAccounts must be set", i)
+		}
+		for _, sa := range g.ServiceAccounts {
+			if namespace, name, ok := strings.Cut(sa, "/"); !ok || namespace == "" || name == "" {
+				return nil, fmt.Errorf("grants[%d]: service account %q must be namespace/name", i, sa)
+			}
+		}
+		if len(g.Capabilities) == 0 {
+			return nil, fmt.Errorf("grants[%d]: capabilities must not be empty", i)
+		}
+		if g.Capabilities, err = normalizeCapabilities(g.Capabilities); err != nil {
+			return nil, fmt.Errorf("grants[%d]: %w", i, err)
+		}
+		grants = append(grants, g)
+	}
+
+	return admission.NewRule(AllowedCapabilities, admission.SeverityHigh, func(pod *corev1.Pod) []admission.Violation {
+		if pod.Spec.OS != nil && pod.Spec.OS.Name == corev1.Windows {
+			return nil
+		}
+		permitted := slices.Clone(allowed)
+		for _, g := range grants {
+			if g.matches(pod) {
+				permitted = append(permitted, g.Capabilities...)
+			}
+		}
+		slices.Sort(permitted)
+		permitted = slices.Compact(permitted)
+
+		var violations []admission.Violation
+		for _, c := range admission.AllContainers(pod) {
+			var caps *corev1.Capabilities
+			if sc := c.Container.SecurityContext; sc != nil {
+				caps = sc.Capabilities
+			}
+			if caps == nil || !slices.ContainsFunc(caps.Drop, func(d corev1.Capability) bool {
+				return normalizeCapability(string(d)) == capabilityAll
+			}) {
+				violations = append(violations, admission.Violationf("%s: securityContext.capabilities.drop must include ALL", c))
+			}
+			if caps == nil {
+				continue
+			}
+			var forbidden []string
+			for _, add := range caps.Add {
+				name := normalizeCapability(string(add))
+				if !slices.Contains(permitted, name) && !slices.Contains(forbidden, name) {
+					forbidden = append(forbidden, name)
+				}
+			}
+			if len(forbidden) > 0 {
+				violations = append(violations, admission.Violationf("%s: adding capabilities %s is not allowed (allowed: [%s])",
+					c, strings.Join(forbidden, ", "), strings.Join(permitted, ", ")))
+			}
+		}
+		return violations
+	}), nil
+}
+
+// matches reports whether the grant applies to the pod; a pod without a service account runs as default
+func (g CapabilityGrant) matches(pod *corev1.Pod) bool {
+	if slices.Contains(g.Namespaces, pod.Namespace) {
+		return true
+	}
+	sa := pod.Spec.ServiceAccountName
+	if sa == "" {
+		sa = "default"
+	}
+	return slices.Contains(g.ServiceAccounts, pod.Namespace+"/"+sa)
+}
+
+func normalizeCapabilities(names []string) ([]string, error) {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		n := normalizeCapability(name)
+		if !capabilityName.MatchString(n) {
+			return nil, fmt.Errorf("invalid capability %q", name)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// normalizeCapability turns cap_sys_admin into SYS_ADMIN
+func normalizeCapability(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	return strings.TrimPrefix(name, "CAP_")
+}
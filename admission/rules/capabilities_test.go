@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCapabilities(t *testing.T) {
+	rule, err := Capabilities(CapabilitiesParams{
+		Allowed: []string{"cap_net_bind_service"},
+		Grants:  []CapabilityGrant{{Namespaces: []string{"monitoring"}, Capabilities: []string{"CAP_SYS_TIME"}}},
+	})
+	if err != nil {
+		t.Fatalf("Capabilities: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		caps       *corev1.Capabilities
+		violations []string
+	}{
+		{"nothing dropped", "default", nil, []string{"drop must include ALL"}},
+		{"drop ALL", "default", &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}, nil},
+		{"drop all in lower case", "default", &corev1.Capabilities{Drop: []corev1.Capability{"all"}}, nil},
+		{"drop a single capability", "default", &corev1.Capabilities{Drop: []corev1.Capability{"NET_RAW"}}, []string{"drop must include ALL"}},
+		{"add allowed", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"NET_BIND_SERVICE"},
+		}, nil},
+		{"add allowed with prefix and case", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{" Cap_Net_Bind_Service "},
+		}, nil},
+		{"add cap_sys_admin", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"cap_sys_admin"},
+		}, []string{"adding capabilities SYS_ADMIN is not allowed (allowed: [NET_BIND_SERVICE])"}},
+		{"add the same capability twice", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"SYS_ADMIN", "CAP_SYS_ADMIN"},
+		}, []string{"adding capabilities SYS_ADMIN is not"}},
+		{"add ALL", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"ALL"},
+		}, []string{"adding capabilities ALL is not allowed"}},
+		{"add all in lower case", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"all"},
+		}, []string{"adding capabilities ALL is not allowed"}},
+		{"granted to the namespace", "monitoring", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"sys_time"},
+		}, nil},
+		{"granted elsewhere", "default", &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"SYS_TIME"},
+		}, []string{"adding capabilities SYS_TIME is not allowed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := podWith(corev1.Container{Name: "app", Image: "nginx:1.27", SecurityContext: &corev1.SecurityContext{Capabilities: tt.caps}})
+			pod.Namespace = tt.namespace
+			got := rule.Evaluate(pod)
+			if len(got) != len(tt.violations) {
+				t.Fatalf("got %v, want %q", got, tt.violations)
+			}
+			for i, v := range got {
+				if !strings.Contains(v.Message, tt.violations[i]) {
+					t.Errorf("violation %d = %q, want %q", i, v.Message, tt.violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilitiesParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params CapabilitiesParams
+		err    string
+	}{
+		{"invalid name", CapabilitiesParams{Allowed: []string{"NET-ADMIN"}}, `allowed: invalid capability "NET-ADMIN"`},
+		{"empty name", CapabilitiesParams{Allowed: []string{"CAP_"}}, `invalid capability "CAP_"`},
+		{"grant without subject", CapabilitiesParams{Grants: []CapabilityGrant{{Capabilities: []string{"NET_ADMIN"}}}}, "namespaces or serviceAccounts must be set"},
+		{"grant with bare service account", CapabilitiesParams{Grants: []CapabilityGrant{{
+			ServiceAccounts: []string{"cilium"}, Capabilities: []string{"NET_ADMIN"},
+		}}}, `service account "cilium" must be namespace/name`},
+		{"grant without capabilities", CapabilitiesParams{Grants: []CapabilityGrant{{Namespaces: []string{"x"}}}}, "capabilities must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Capabilities(tt.params); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNormalizeCapability(t *testing.T) {
+	for in, want := range map[string]string{
+		"SYS_ADMIN":     "SYS_ADMIN",
+		"cap_sys_admin": "SYS_ADMIN",
+		"CAP_SYS_ADMIN": "SYS_ADMIN",
+		"Cap_Net_Raw":   "NET_RAW",
+		" all ":         "ALL",
+		"ALL":           "ALL",
+	} {
+		if got := normalizeCapability(in); got != want {
+			t.Errorf("normalizeCapability(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
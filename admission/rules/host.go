@@ -0,0 +1,51 @@
+package rules
+
+import (
+	"path"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// dockerSocketPaths - host paths that hand out the container runtime
+var dockerSocketPaths = []string{
+	"/var/run/docker.sock",
+	"/run/docker.sock",
+}
+
+// HostAccess forbids sharing the host network, PID and IPC namespaces
+func HostAccess() admission.Rule {
+	return admission.NewRule(NoHostAccess, admission.SeverityCritical, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		if pod.Spec.HostNetwork {
+			violations = append(violations, admission.Violationf("hostNetwork is forbidden"))
+		}
+		if pod.Spec.HostPID {
+			violations = append(violations, admission.Violationf("hostPID is forbidden"))
+		}
+		if pod.Spec.HostIPC {
+			violations = append(violations, admission.Violationf("hostIPC is forbidden"))
+		}
+		return violations
+	})
+}
+
+// DockerSocket forbids hostPath volumes pointing at the docker socket
+func DockerSocket() admission.Rule {
+	return admission.NewRule(NoDockerSocket, admission.SeverityCritical, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		for _, vol := range pod.Spec.Volumes {
+			if vol.HostPath == nil {
+				continue
+			}
+			p := path.Clean(vol.HostPath.Path)
+			for _, sock := range dockerSocketPaths {
+				if p == sock {
+					violations = append(violations, admission.Violationf("volume %q: mounting %s is forbidden", vol.Name, sock))
+				}
+			}
+		}
+		return violations
+	})
+}
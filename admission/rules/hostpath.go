@@ -0,0 +1,118 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultDeniedHostPaths - container runtime sockets. Whoever can talk to them controls the node,
+// and a read-only mount does not stop anyone from connecting to a socket.
+var DefaultDeniedHostPaths = []string{
+	"/run/docker.sock",
+	"/run/containerd/containerd.sock",
+	"/run/crio/crio.sock",
+}
+
+// HostPathParams - policy params of the allowed-host-paths rule.
+//
+//	pathPrefixes: ["/var/log"]       # hostPath volumes allowed below these, mounted readOnly only
+//	deniedPaths: ["/run/docker.sock"] # never allowed, nor what is above or below them; defaults to the runtime sockets
+type HostPathParams struct {
+	PathPrefixes []string `json:"pathPrefixes,omitempty"`
+	DeniedPaths  []string `json:"deniedPaths"`
+}
+
+func hostPathFactory(params json.RawMessage) (admission.Rule, error) {
+	p := HostPathParams{}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.DeniedPaths == nil {
+		p.DeniedPaths = slices.Clone(DefaultDeniedHostPaths)
+	}
+	return HostPaths(p)
+}
+
+// HostPaths denies hostPath volumes unless they are below one of the allowed prefixes and every container
+// mounts them readOnly. Denied paths, and directories that contain them, are rejected even below an allowed prefix.
+// Paths are compared cleaned, with /var/run read as /run, so /var/run/../run/docker.sock is /run/docker.sock.
+func HostPaths(p HostPathParams) (admission.Rule, error) {
+	prefixes, err := canonicalHostPaths(p.PathPrefixes)
+	if err != nil {
+		return nil, fmt.Errorf("pathPrefixes: %w", err)
+	}
+	denied, err := canonicalHostPaths(p.DeniedPaths)
+	if err != nil {
+		return nil, fmt.Errorf("deniedPaths: %w", err)
+	}
+	allowedList := strings.Join(prefixes, ", ")
+
+	return admission.NewRule(AllowedHostPaths, admission.SeverityCritical, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		for _, vol := range pod.Spec.Volumes {
+			if vol.HostPath == nil {
+				continue
+			}
+			hostPath := vol.HostPath.Path
+			if !path.IsAbs(hostPath) {
+				violations = append(violations, admission.Violationf("volume %q: hostPath %q must be absolute", vol.Name, hostPath))
+				continue
+			}
+			cleaned := canonicalHostPath(hostPath)
+
+			// A parent directory exposes the denied path as much as the path itself
+			if i := slices.IndexFunc(denied, func(d string) bool { return pathWithin(d, cleaned) || pathWithin(cleaned, d) }); i >= 0 {
+				violations = append(violations, admission.Violationf("volume %q: hostPath %s exposes %s, which is forbidden", vol.Name, hostPath, denied[i]))
+				continue
+			}
+			if !slices.ContainsFunc(prefixes, func(prefix string) bool { return pathWithin(cleaned, prefix) }) {
+				if len(prefixes) == 0 {
+					violations = append(violations, admission.Violationf("volume %q: hostPath volumes are forbidden (%s)", vol.Name, hostPath))
+				} else {
+					violations = append(violations, admission.Violationf("volume %q: hostPath %s is not below an allowed prefix [%s]", vol.Name, hostPath, allowedList))
+				}
+				continue
+			}
+			for _, c := range admission.AllContainers(pod) {
+				for _, m := range c.Container.VolumeMounts {
+					if m.Name == vol.Name && !m.ReadOnly {
+						violations = append(violations, admission.Violationf("%s: hostPath volume %q (%s) must be mounted readOnly: true", c, vol.Name, hostPath))
+					}
+				}
+			}
+		}
+		return violations
+	}), nil
+}
+
+func canonicalHostPaths(paths []string) ([]string, error) {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if !path.IsAbs(p) {
+			return nil, fmt.Errorf("%q must be an absolute path", p)
+		}
+		out = append(out, canonicalHostPath(p))
+	}
+	return out, nil
+}
+
+// canonicalHostPath cleans p and reads /var/run as /run, it is a symlink to it on current distributions
+func canonicalHostPath(p string) string {
+	p = path.Clean(p)
+	if p == "/var/run" || strings.HasPrefix(p, "/var/run/") {
+		p = "/run" + strings.TrimPrefix(p, "/var/run")
+	}
+	return p
+}
+
+// pathWithin reports whether p is dir or below it, by whole path segments
+func pathWithin(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
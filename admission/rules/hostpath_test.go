@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestHostPaths(t *testing.T) {
+	rule, err := HostPaths(HostPathParams{
+		PathPrefixes: []string{"/var/log/", "/var/run/secrets-store"},
+		DeniedPaths:  DefaultDeniedHostPaths,
+	})
+	if err != nil {
+		t.Fatalf("HostPaths: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		readWrite bool
+		violation string
+	}{
+		{"below the prefix", "/var/log/pods", false, ""},
+		{"the prefix itself", "/var/log", false, ""},
+		{"trailing slash", "/var/log/pods/", false, ""},
+		{"double slashes", "/var//log///pods", false, ""},
+		{"dot segments that stay inside", "/var/log/./pods/../containers", false, ""},
+		{"dot segments that escape", "/var/log/../../etc", false, "/var/log/../../etc is not below an allowed prefix"},
+		{"dot segments into a sibling", "/var/log/../lib/kubelet", false, "is not below an allowed prefix"},
+		{"prefix only on a string, not a segment", "/var/logs", false, "/var/logs is not below an allowed prefix"},
+		{"prefix with a suffix", "/var/log-archive/x", false, "is not below an allowed prefix"},
+		{"parent of the prefix", "/var", false, "is not below an allowed prefix"},
+		{"root", "/", false, "hostPath / exposes /run/docker.sock"},
+		{"relative", "var/log", false, `hostPath "var/log" must be absolute`},
+		{"read-write mount", "/var/log/pods", true, "must be mounted readOnly: true"},
+		{"runtime socket", "/run/containerd/containerd.sock", false, "exposes /run/containerd/containerd.sock, which is forbidden"},
+		{"socket through /var/run", "/var/run/docker.sock", false, "exposes /run/docker.sock"},
+		{"socket through dot segments", "/var/run/../run/./docker.sock", false, "exposes /run/docker.sock"},
+		{"directory that contains a socket", "/run/containerd/", false, "exposes /run/containerd/containerd.sock"},
+		{"/var/run prefix read as /run", "/run/secrets-store/app", false, ""},
+		{"sibling of /var/run prefix", "/run/secrets-store-other", false, "is not below an allowed prefix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := podWith(corev1.Container{
+				Name:         "app",
+				Image:        "nginx:1.27",
+				VolumeMounts: []corev1.VolumeMount{{Name: "host", MountPath: "/host", ReadOnly: !tt.readWrite}},
+			})
+			pod.Spec.Volumes = []corev1.Volume{{
+				Name:         "host",
+				VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: tt.path}},
+			}}
+			got := rule.Evaluate(pod)
+			if tt.violation == "" {
+				if len(got) > 0 {
+					t.Fatalf("got %v, want no violations", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.Contains(got[0].Message, tt.violation) {
+				t.Fatalf("got %v, want %q", got, tt.violation)
+			}
+		})
+	}
+}
+
+func TestHostPathsWithoutPrefixes(t *testing.T) {
+	rule, err := HostPaths(HostPathParams{})
+	if err != nil {
+		t.Fatalf("HostPaths: %v", err)
+	}
+	pod := podWith(corev1.Container{Name: "app", Image: "nginx:1.27"})
+	pod.Spec.Volumes = []corev1.Volume{{
+		Name:         "host",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log"}},
+	}}
+	if got := rule.Evaluate(pod); len(got) != 1 || !strings.Contains(got[0].Message, "hostPath volumes are forbidden") {
+		t.Fatalf("got %v, want every hostPath forbidden", got)
+	}
+}
+
+func TestCanonicalHostPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"/var/log/":                "/var/log",
+		"/var/log/../../etc":       "/etc",
+		"/var/log/../../../../etc": "/etc",
+		"//var//log":               "/var/log",
+		"/var/run":                 "/run",
+		"/var/run/docker.sock":     "/run/docker.sock",
+		"/var/running":             "/var/running",
+		"/var/./run/../run/crio/":  "/run/crio",
+		"/":                        "/",
+	} {
+		if got := canonicalHostPath(in); got != want {
+			t.Errorf("canonicalHostPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	tests := []struct {
+		p, dir string
+		want   bool
+	}{
+		{"/var/log", "/var/log", true},
+		{"/var/log/pods", "/var/log", true},
+		{"/var/logs", "/var/log", false},
+		{"/var/log-archive", "/var/log", false},
+		{"/var", "/var/log", false},
+		{"/etc", "/", true},
+	}
+	for _, tt := range tests {
+		if got := pathWithin(tt.p, tt.dir); got != tt.want {
+			t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.p, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestHostPathsParams(t *testing.T) {
+	if _, err := HostPaths(HostPathParams{PathPrefixes: []string{"var/log"}}); err == nil || !strings.Contains(err.Error(), "pathPrefixes") {
+		t.Errorf("relative prefix: %v", err)
+	}
+	if _, err := HostPaths(HostPathParams{DeniedPaths: []string{"docker.sock"}}); err == nil || !strings.Contains(err.Error(), "deniedPaths") {
+		t.Errorf("relative denied path: %v", err)
+	}
+}
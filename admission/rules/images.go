@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"admission"
+	"admission/image"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultAllowedRegistries - images from any other registry are rejected
+var DefaultAllowedRegistries = []string{
+	"docker.io",
+	"ghcr.io",
+	"registry.k8s.io",
+	"quay.io",
+}
+
+// LatestTag forbids images without a tag or with the latest tag, digests are fine
+func LatestTag() admission.Rule {
+	return admission.NewRule(NoLatestTag, admission.SeverityMedium, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		for _, c := range admission.AllContainers(pod) {
+			ref, err := image.Parse(c.Container.Image)
+			if err != nil {
+				violations = append(violations, admission.Violationf("%s: %v", c, err))
+				continue
+			}
+			if ref.IsLatest() {
+				violations = append(violations, admission.Violationf("%s: image %q (%s) must use an explicit tag other than latest", c, c.Container.Image, ref))
+			}
+		}
+		return violations
+	})
+}
+
+// RegistriesParams - policy params of the allowed-registries rule.
+//
+//	registries: ["docker.io"]                # any repository of these registries
+//	patterns: ["ghcr.io/cooler-sai/*"]       # registry/repository globs, ** crosses path segments
+//	requireDigest: true                      # images must be pinned with @sha256:
+type RegistriesParams struct {
+	Registries    []string `json:"registries,omitempty"`
+	Patterns      []string `json:"patterns,omitempty"`
+	RequireDigest bool     `json:"requireDigest,omitempty"`
+}
+
+func registriesFactory(params json.RawMessage) (admission.Rule, error) {
+	p := RegistriesParams{}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Registries) == 0 && len(p.Patterns) == 0 {
+		p.Registries = slices.Clone(DefaultAllowedRegistries)
+	}
+	return Registries(p)
+}
+
+// Registries only lets images in whose normalised name matches one of the allowed registries or patterns,
+// and optionally only when they are pinned by digest
+func Registries(p RegistriesParams) (admission.Rule, error) {
+	globs := make([]string, 0, len(p.Registries)+len(p.Patterns))
+	for _, registry := range p.Registries {
+		if registry == "" || strings.ContainsAny(registry, "/*?") {
+			return nil, fmt.Errorf("registry %q must be a plain host, use patterns for repositories", registry)
+		}
+		globs = append(globs, registry+"/**")
+	}
+	globs = append(globs, p.Patterns...)
+
+	patterns := make([]image.Pattern, 0, len(globs))
+	for _, glob := range globs {
+		pattern, err := image.CompilePattern(glob)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	allowed := strings.Join(globs, ", ")
+
+	return admission.NewRule(AllowedRegistries, admission.SeverityHigh, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		for _, c := range admission.AllContainers(pod) {
+			ref, err := image.Parse(c.Container.Image)
+			if err != nil {
+				violations = append(violations, admission.Violationf("%s: %v", c, err))
+				continue
+			}
+			matched := slices.ContainsFunc(patterns, func(pattern image.Pattern) bool {
+				return pattern.Match(ref)
+			})
+			if !matched {
+				violations = append(violations, admission.Violationf("%s: image %q (%s) is not from an allowed registry or repository [%s]", c, c.Container.Image, ref, allowed))
+			}
+			if p.RequireDigest && ref.Digest == "" {
+				violations = append(violations, admission.Violationf("%s: image %q (%s) must be pinned by @sha256: digest", c, c.Container.Image, ref))
+			}
+		}
+		return violations
+	}), nil
+}
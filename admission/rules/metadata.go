@@ -0,0 +1,125 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultRequiredLabels - the recommended label that names the application
+var DefaultRequiredLabels = []MetadataRequirement{{Key: "app.kubernetes.io/name"}}
+
+// MetadataParams - policy params of the required-metadata rule.
+//
+//	labels:
+//	  - key: app.kubernetes.io/name
+//	  - key: team
+//	    values: ["payments", "platform"]       # one of these
+//	  - key: cost-center
+//	    pattern: "cc-[0-9]{4}"                 # the whole value must match
+//	annotations:
+//	  - key: security.lab/owner
+type MetadataParams struct {
+	Labels      []MetadataRequirement `json:"labels,omitempty"`
+	Annotations []MetadataRequirement `json:"annotations,omitempty"`
+}
+
+// MetadataRequirement requires a label or annotation. Without pattern or values any non-empty value will do.
+type MetadataRequirement struct {
+	Key     string   `json:"key"`
+	Pattern string   `json:"pattern,omitempty"`
+	Values  []string `json:"values,omitempty"`
+}
+
+func metadataFactory(params json.RawMessage) (admission.Rule, error) {
+	p := MetadataParams{}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Labels) == 0 && len(p.Annotations) == 0 {
+		p.Labels = slices.Clone(DefaultRequiredLabels)
+	}
+	return Metadata(p)
+}
+
+// Metadata requires labels and annotations on pods and workload pod templates, so the owner of a pod
+// can always be found from the pod itself
+func Metadata(p MetadataParams) (admission.Rule, error) {
+	labels, err := compileRequirements("labels", p.Labels)
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := compileRequirements("annotations", p.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return admission.NewRule(RequiredMetadata, admission.SeverityLow, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		for _, r := range labels {
+			if msg := r.check(pod.Labels); msg != "" {
+				violations = append(violations, admission.Violationf("label %s", msg))
+			}
+		}
+		for _, r := range annotations {
+			if msg := r.check(pod.Annotations); msg != "" {
+				violations = append(violations, admission.Violationf("annotation %s", msg))
+			}
+		}
+		return violations
+	}), nil
+}
+
+type requirement struct {
+	MetadataRequirement
+	pattern *regexp.Regexp
+}
+
+func compileRequirements(field string, reqs []MetadataRequirement) ([]requirement, error) {
+	compiled := make([]requirement, 0, len(reqs))
+	seen := make(map[string]bool)
+	for i, r := range reqs {
+		if errs := validation.IsQualifiedName(r.Key); len(errs) > 0 {
+			return nil, fmt.Errorf("%s[%d]: invalid key %q: %s", field, i, r.Key, strings.Join(errs, "; "))
+		}
+		if seen[r.Key] {
+			return nil, fmt.Errorf("%s[%d]: key %q is listed twice", field, i, r.Key)
+		}
+		seen[r.Key] = true
+		if r.Pattern != "" && len(r.Values) > 0 {
+			return nil, fmt.Errorf("%s[%d] %q: set pattern or values, not both", field, i, r.Key)
+		}
+		c := requirement{MetadataRequirement: r}
+		if r.Pattern != "" {
+			// Anchored, so "cc-[0-9]+" does not accept "xcc-1y"
+			pattern, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d] %q: invalid pattern: %w", field, i, r.Key, err)
+			}
+			c.pattern = pattern
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// check returns what is wrong with the key in values, empty when it is fine
+func (r requirement) check(values map[string]string) string {
+	value, ok := values[r.Key]
+	switch {
+	case !ok || (value == "" && r.pattern == nil && len(r.Values) == 0):
+		return fmt.Sprintf("%q is required", r.Key)
+	case r.pattern != nil && !r.pattern.MatchString(value):
+		return fmt.Sprintf("%s=%q must match %s", r.Key, value, r.Pattern)
+	case len(r.Values) > 0 && !slices.Contains(r.Values, value):
+		return fmt.Sprintf("%s=%q must be one of [%s]", r.Key, value, strings.Join(r.Values, ", "))
+	}
+	return ""
+}
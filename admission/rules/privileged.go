@@ -0,0 +1,34 @@
+package rules
+
+import (
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Privileged forbids privileged: true on any container, and Windows HostProcess containers,
+// their equivalent. hostProcess may be set on the pod, containers inherit it unless they override it.
+func Privileged() admission.Rule {
+	return admission.NewRule(NoPrivileged, admission.SeverityCritical, func(pod *corev1.Pod) []admission.Violation {
+		var podHostProcess *bool
+		if sc := pod.Spec.SecurityContext; sc != nil && sc.WindowsOptions != nil {
+			podHostProcess = sc.WindowsOptions.HostProcess
+		}
+
+		var violations []admission.Violation
+		for _, ref := range admission.AllContainers(pod) {
+			sc := ref.Container.SecurityContext
+			if sc != nil && sc.Privileged != nil && *sc.Privileged {
+				violations = append(violations, admission.Violationf("%s: privileged containers are forbidden", ref))
+			}
+			hostProcess := podHostProcess
+			if sc != nil && sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil {
+				hostProcess = sc.WindowsOptions.HostProcess
+			}
+			if hostProcess != nil && *hostProcess {
+				violations = append(violations, admission.Violationf("%s: Windows HostProcess containers are forbidden", ref))
+			}
+		}
+		return violations
+	})
+}
@@ -0,0 +1,34 @@
+package rules
+
+import (
+	"strings"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Limits requires cpu and memory limits on every container. Ephemeral containers are skipped,
+// the API server does not allow resources on them.
+func Limits() admission.Rule {
+	return admission.NewRule(ResourceLimits, admission.SeverityMedium, func(pod *corev1.Pod) []admission.Violation {
+		var violations []admission.Violation
+		for _, ref := range admission.AllContainers(pod) {
+			if ref.Kind == admission.KindEphemeralContainer {
+				continue
+			}
+			limits := ref.Container.Resources.Limits
+			var missing []string
+			if _, ok := limits[corev1.ResourceCPU]; !ok {
+				missing = append(missing, "cpu")
+			}
+			if _, ok := limits[corev1.ResourceMemory]; !ok {
+				missing = append(missing, "memory")
+			}
+			if len(missing) > 0 {
+				violations = append(violations, admission.Violationf("%s: resources.limits.%s must be set", ref, strings.Join(missing, ", ")))
+			}
+		}
+		return violations
+	})
+}
@@ -0,0 +1,124 @@
+// Package rules holds the built-in pod security rules.
+// Every webhook picks the ones it needs from Builtin, builds them from policy params with New,
+// or calls the constructors directly. Opt-in rules would start denying workloads that were admitted
+// before, they are left out of Builtin and only built with New, when a policy asks for them.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"admission"
+)
+
+// Names of the built-in rules
+const (
+	NoPrivileged          = "no-privileged"
+	NoLatestTag           = "no-latest-tag"
+	ResourceLimits        = "resource-limits"
+	RunAsNonRoot          = "run-as-non-root"
+	NoPrivilegeEscalation = "no-privilege-escalation"
+	NoHostAccess          = "no-host-access"
+	AllowedRegistries     = "allowed-registries"
+	NoDockerSocket        = "no-docker-socket"
+	AllowedCapabilities   = "allowed-capabilities"
+	AllowedHostPaths      = "allowed-host-paths"
+	RequiredMetadata      = "required-metadata"
+)
+
+// Factory builds a rule from the params block of a policy file.
+// Empty params mean the rule defaults.
+type Factory func(params json.RawMessage) (admission.Rule, error)
+
+// builtin - every built-in rule in README order
+var builtin = []struct {
+	name    string
+	factory Factory
+}{
+	{NoPrivileged, noParams(Privileged)},
+	{NoLatestTag, noParams(LatestTag)},
+	{ResourceLimits, noParams(Limits)},
+	{RunAsNonRoot, noParams(NonRoot)},
+	{NoPrivilegeEscalation, noParams(PrivilegeEscalation)},
+	{NoHostAccess, noParams(HostAccess)},
+	{AllowedRegistries, registriesFactory},
+	{NoDockerSocket, noParams(DockerSocket)},
+	{AllowedCapabilities, capabilitiesFactory},
+	{AllowedHostPaths, hostPathFactory},
+	{RequiredMetadata, metadataFactory},
+}
+
+// optIn - rules Builtin leaves out, a policy has to list them
+var optIn = map[string]bool{
+	AllowedCapabilities: true,
+	AllowedHostPaths:    true,
+	RequiredMetadata:    true,
+}
+
+// Builtin returns a registry with every built-in rule that is not opt-in, using its default settings
+func Builtin() *admission.Registry {
+	registry := admission.NewRegistry()
+	for _, b := range builtin {
+		if optIn[b.name] {
+			continue
+		}
+		rule, err := b.factory(nil)
+		if err != nil {
+			panic(fmt.Sprintf("built-in rule %q: %v", b.name, err))
+		}
+		registry.MustRegister(rule)
+	}
+	return registry
+}
+
+// Names returns the names of all built-in rules, opt-in ones included
+func Names() []string {
+	names := make([]string, 0, len(builtin))
+	for _, b := range builtin {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+// New builds the named built-in rule from its policy params
+func New(name string, params json.RawMessage) (admission.Rule, error) {
+	for _, b := range builtin {
+		if b.name == name {
+			rule, err := b.factory(params)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", name, err)
+			}
+			return rule, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown rule %q (known: %v)", name, Names())
+}
+
+// noParams wraps constructors of rules that have nothing to configure
+func noParams(constructor func() admission.Rule) Factory {
+	return func(params json.RawMessage) (admission.Rule, error) {
+		if !emptyParams(params) {
+			return nil, fmt.Errorf("rule takes no params")
+		}
+		return constructor(), nil
+	}
+}
+
+// decodeParams strictly decodes params into v, unknown fields are an error
+func decodeParams(params json.RawMessage, v any) error {
+	if emptyParams(params) {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+func emptyParams(params json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(params)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) || bytes.Equal(trimmed, []byte("{}"))
+}
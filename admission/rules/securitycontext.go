@@ -0,0 +1,48 @@
+package rules
+
+import (
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NonRoot requires runAsNonRoot: true, set either on the pod or on the container
+func NonRoot() admission.Rule {
+	return admission.NewRule(RunAsNonRoot, admission.SeverityHigh, func(pod *corev1.Pod) []admission.Violation {
+		podNonRoot := pod.Spec.SecurityContext != nil &&
+			pod.Spec.SecurityContext.RunAsNonRoot != nil &&
+			*pod.Spec.SecurityContext.RunAsNonRoot
+
+		var violations []admission.Violation
+		for _, ref := range admission.AllContainers(pod) {
+			nonRoot := podNonRoot
+			// The container setting overrides the pod one
+			if sc := ref.Container.SecurityContext; sc != nil && sc.RunAsNonRoot != nil {
+				nonRoot = *sc.RunAsNonRoot
+			}
+			if !nonRoot {
+				violations = append(violations, admission.Violationf("%s: runAsNonRoot must be true", ref))
+			}
+		}
+		return violations
+	})
+}
+
+// PrivilegeEscalation requires allowPrivilegeEscalation: false. Unset counts as allowed, the kernel only stops
+// setuid binaries from gaining privileges when no_new_privs is set. Windows pods have no such setting and
+// are skipped, the same way Pod Security restricted does.
+func PrivilegeEscalation() admission.Rule {
+	return admission.NewRule(NoPrivilegeEscalation, admission.SeverityHigh, func(pod *corev1.Pod) []admission.Violation {
+		if pod.Spec.OS != nil && pod.Spec.OS.Name == corev1.Windows {
+			return nil
+		}
+		var violations []admission.Violation
+		for _, ref := range admission.AllContainers(pod) {
+			sc := ref.Container.SecurityContext
+			if sc == nil || sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+				violations = append(violations, admission.Violationf("%s: allowPrivilegeEscalation must be false", ref))
+			}
+		}
+		return violations
+	})
+}
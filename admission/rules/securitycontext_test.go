@@ -0,0 +1,42 @@
+package rules
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPrivilegeEscalation(t *testing.T) {
+	tests := []struct {
+		name       string
+		os         corev1.OSName
+		sc         *corev1.SecurityContext
+		violations int
+	}{
+		{"no securityContext", "", nil, 1},
+		{"unset", "", &corev1.SecurityContext{}, 1},
+		{"true", "", &corev1.SecurityContext{AllowPrivilegeEscalation: ptr(true)}, 1},
+		{"false", "", &corev1.SecurityContext{AllowPrivilegeEscalation: ptr(false)}, 0},
+		{"windows unset", corev1.Windows, nil, 0},
+	}
+	rule := PrivilegeEscalation()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := podWith(corev1.Container{Name: "app", Image: "nginx:1.27", SecurityContext: tt.sc})
+			if tt.os != "" {
+				pod.Spec.OS = &corev1.PodOS{Name: tt.os}
+			}
+			if got := rule.Evaluate(pod); len(got) != tt.violations {
+				t.Errorf("got %d violations %v, want %d", len(got), got, tt.violations)
+			}
+		})
+	}
+}
+
+func podWith(containers ...corev1.Container) *corev1.Pod {
+	return &corev1.Pod{Spec: corev1.PodSpec{Containers: containers}}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,164 @@
+// Package server is the HTTPS server every webhook runs: timeouts so a slow client can not hold
+// connections open, /healthz and /readyz for the kubelet, and a graceful drain on SIGTERM.
+//
+// Under failurePolicy: Fail the API server rejects pods while no webhook replica answers,
+// so a rolling restart must never leave the Service without a ready endpoint: a replica
+// only turns ready once its certificate and policy are loaded, and on SIGTERM it first turns
+// unready, keeps serving until the endpoint is gone and only then finishes in-flight reviews.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Timeouts of every webhook server. An AdmissionReview is small and the API server gives up
+// after the webhook timeout (at most 30s) anyway.
+const (
+	ReadHeaderTimeout = 5 * time.Second
+	ReadTimeout       = 10 * time.Second
+	WriteTimeout      = 30 * time.Second
+	IdleTimeout       = 90 * time.Second
+)
+
+var (
+	// DrainDelay is how long a terminating webhook keeps serving after /readyz started failing,
+	// long enough for the endpoint to be removed from the Service
+	DrainDelay = 5 * time.Second
+	// ShutdownTimeout bounds waiting for in-flight reviews; together with DrainDelay it must
+	// stay below terminationGracePeriodSeconds (30s by default)
+	ShutdownTimeout = 15 * time.Second
+)
+
+// New returns a server for handler with the timeouts set
+func New(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       ReadTimeout,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       IdleTimeout,
+	}
+}
+
+// Check is a named readiness condition, nil error means ready
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// Health serves /healthz (the process is alive) and /readyz (every check passes and
+// the server is not shutting down)
+type Health struct {
+	mu       sync.Mutex
+	checks   []Check
+	draining atomic.Bool
+}
+
+// AddCheck adds a readiness check
+func (h *Health) AddCheck(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, Check{Name: name, Check: check})
+}
+
+// Register adds /healthz and /readyz to mux
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", h.serveReady)
+}
+
+// Ready returns why the server is not ready, nil when it is
+func (h *Health) Ready() error {
+	if h.draining.Load() {
+		return errors.New("shutting down")
+	}
+	h.mu.Lock()
+	checks := h.checks
+	h.mu.Unlock()
+
+	var failed []string
+	for _, c := range checks {
+		if err := c.Check(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", c.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (h *Health) serveReady(w http.ResponseWriter, _ *http.Request) {
+	if err := h.Ready(); err != nil {
+		http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// CertificateFiles is a readiness check that the key pair can be loaded
+func CertificateFiles(certFile, keyFile string) func() error {
+	return func() error {
+		_, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return err
+	}
+}
+
+// Run serves until SIGTERM or SIGINT and then drains: /readyz fails for DrainDelay, then
+// in-flight requests get up to ShutdownTimeout to finish. TLS comes from certFile/keyFile or
+// server.TLSConfig; with neither it serves plain HTTP, for local testing only.
+// It returns nil after a clean shutdown.
+func Run(server *http.Server, certFile, keyFile string, health *Health) error {
+	errs := make(chan error, 1)
+	go func() {
+		var err error
+		if certFile == "" && server.TLSConfig == nil {
+			err = server.ListenAndServe()
+		} else {
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		}
+		errs <- err
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("🛑 %s received, draining for %s", sig, DrainDelay)
+	}
+
+	if health != nil {
+		health.draining.Store(true)
+	}
+	time.Sleep(DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Printf("👋 Server stopped")
+	return nil
+}
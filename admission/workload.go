@@ -0,0 +1,98 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkloadKinds lists every kind PodFromObject understands, as "group/Kind" ("" is the core group)
+var WorkloadKinds = []string{
+	"/Pod",
+	"/ReplicationController",
+	"apps/Deployment",
+	"apps/ReplicaSet",
+	"apps/StatefulSet",
+	"apps/DaemonSet",
+	"batch/Job",
+	"batch/CronJob",
+}
+
+// PodFromObject returns the pod, or the pod template of a workload, so the same
+// pod rules can check a Deployment at kubectl apply time instead of when its pods are created.
+// ok is false for kinds that carry no pod spec.
+//
+// For workloads the returned pod has the template metadata (labels, annotations)
+// and the namespace of the workload.
+func PodFromObject(kind metav1.GroupVersionKind, raw []byte) (pod *corev1.Pod, ok bool, err error) {
+	var template *corev1.PodTemplateSpec
+	var meta *metav1.ObjectMeta
+
+	switch kind.Group + "/" + kind.Kind {
+	case "/Pod":
+		pod = &corev1.Pod{}
+		if err := json.Unmarshal(raw, pod); err != nil {
+			return nil, true, fmt.Errorf("could not decode Pod: %w", err)
+		}
+		return pod, true, nil
+	case "/ReplicationController":
+		var rc corev1.ReplicationController
+		if err := json.Unmarshal(raw, &rc); err != nil {
+			return nil, true, fmt.Errorf("could not decode ReplicationController: %w", err)
+		}
+		meta, template = &rc.ObjectMeta, rc.Spec.Template
+	case "apps/Deployment":
+		var d appsv1.Deployment
+		if err := json.Unmarshal(raw, &d); err != nil {
+			return nil, true, fmt.Errorf("could not decode Deployment: %w", err)
+		}
+		meta, template = &d.ObjectMeta, &d.Spec.Template
+	case "apps/ReplicaSet":
+		var rs appsv1.ReplicaSet
+		if err := json.Unmarshal(raw, &rs); err != nil {
+			return nil, true, fmt.Errorf("could not decode ReplicaSet: %w", err)
+		}
+		meta, template = &rs.ObjectMeta, &rs.Spec.Template
+	case "apps/StatefulSet":
+		var ss appsv1.StatefulSet
+		if err := json.Unmarshal(raw, &ss); err != nil {
+			return nil, true, fmt.Errorf("could not decode StatefulSet: %w", err)
+		}
+		meta, template = &ss.ObjectMeta, &ss.Spec.Template
+	case "apps/DaemonSet":
+		var ds appsv1.DaemonSet
+		if err := json.Unmarshal(raw, &ds); err != nil {
+			return nil, true, fmt.Errorf("could not decode DaemonSet: %w", err)
+		}
+		meta, template = &ds.ObjectMeta, &ds.Spec.Template
+	case "batch/Job":
+		var job batchv1.Job
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return nil, true, fmt.Errorf("could not decode Job: %w", err)
+		}
+		meta, template = &job.ObjectMeta, &job.Spec.Template
+	case "batch/CronJob":
+		var cj batchv1.CronJob
+		if err := json.Unmarshal(raw, &cj); err != nil {
+			return nil, true, fmt.Errorf("could not decode CronJob: %w", err)
+		}
+		meta, template = &cj.ObjectMeta, &cj.Spec.JobTemplate.Spec.Template
+	default:
+		return nil, false, nil
+	}
+
+	if template == nil {
+		// A ReplicationController may omit its template
+		return nil, false, nil
+	}
+	pod = &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	pod.Namespace = meta.Namespace
+	return pod, true, nil
+}
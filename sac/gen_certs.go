@@ -1,3 +1,7 @@
+//go:build ignore
+
+// Run with: go run gen_certs.go
+
 package main
 
 import (
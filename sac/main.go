@@ -1,82 +1,43 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 
-	admissionv1 "k8s.io/api/admission/v1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"admission"
+	"admission/metrics"
+	"admission/rules"
+	"admission/server"
 )
 
-// validatePod — логика безопасности
-func validatePod(raw []byte) (bool, string) {
-	var pod corev1.Pod
-	if err := json.Unmarshal(raw, &pod); err != nil {
-		log.Printf("❌ Ошибка декодирования Pod: %v", err)
-		return false, "Could not decode Pod object"
-	}
-
-	for _, container := range pod.Spec.Containers {
-		if container.SecurityContext != nil &&
-			container.SecurityContext.Privileged != nil &&
-			*container.SecurityContext.Privileged {
-			return false, "STOP: Privileged containers are forbidden!"
-		}
-	}
-	return true, "Success: Security check passed"
-}
-
-func handleAdmissionReview(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil || len(body) == 0 {
-		log.Printf("❌ Пустой запрос")
-		http.Error(w, "invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	var ar admissionv1.AdmissionReview
-	if err := json.Unmarshal(body, &ar); err != nil {
-		log.Printf("❌ Ошибка парсинга AdmissionReview: %v", err)
-		http.Error(w, "decoding failed", http.StatusBadRequest)
-		return
-	}
-
-	// Важно: проверяем, что Request не nil
-	if ar.Request == nil {
-		log.Printf("❌ AdmissionReview Request is nil")
-		return
+func main() {
+	// deny — отклонить, warn — пропустить с предупреждением, audit — пропустить и только записать в лог
+	actionName := flag.String("action", "deny", "Действие при нарушении: deny, warn или audit")
+	metricsPort := flag.String("metrics-port", "9090", "Порт для Prometheus /metrics (обычный HTTP)")
+	// fail — отклонить запрос, который не удалось разобрать, ignore — пропустить с предупреждением
+	failureName := flag.String("failure-policy", "fail", "Что делать с объектом, который не удалось разобрать: fail или ignore")
+	flag.Parse()
+
+	action, err := admission.ParseAction(*actionName)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
-
-	allowed, message := validatePod(ar.Request.Object.Raw)
-
-	log.Printf("[WEBHOOK] UID: %s | Allowed: %v | Message: %s", ar.Request.UID, allowed, message)
-
-	responseReview := admissionv1.AdmissionReview{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "admission.k8s.io/v1",
-			Kind:       "AdmissionReview",
-		},
-		Response: &admissionv1.AdmissionResponse{
-			UID:     ar.Request.UID,
-			Allowed: allowed,
-			Result: &metav1.Status{
-				Message: message,
-			},
-		},
+	failure, err := admission.ParseFailurePolicy(*failureName)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(responseReview); err != nil {
-		log.Printf("❌ Ошибка кодирования ответа: %v", err)
-	}
-}
+	// sac проверяет только privileged-контейнеры, вся логика — в общей библиотеке admission
+	validator := admission.NewHandler("sac", admission.Enforce(rules.Privileged(), action))
+	validator.SetFailurePolicy(failure)
 
-func main() {
-	http.HandleFunc("/validate", handleAdmissionReview)
+	// Свой mux вместо глобального: /validate плюс пробы для kubelet
+	health := &server.Health{}
+	mux := http.NewServeMux()
+	health.Register(mux)
+	mux.Handle("/validate", validator)
 
 	// Стандартные пути для K8s TLS Secret
 	certFile := "/certs/tls.crt"
@@ -88,14 +49,25 @@ func main() {
 		certFile = "cert.pem"
 		keyFile = "key.pem"
 	}
+	// /readyz отвечает 200, только когда сертификат читается
+	health.AddCheck("certificate", server.CertificateFiles(certFile, keyFile))
+
+	// Метрики отдаем на отдельном порту, чтобы Prometheus не нужен был TLS
+	if err := metrics.WatchCertificate("sac", certFile); err != nil {
+		log.Printf("⚠️  Метрика срока действия сертификата отключена: %v", err)
+	}
+	go func() {
+		if err := metrics.Serve(*metricsPort); err != nil {
+			log.Fatalf("❌ Ошибка сервера метрик: %v", err)
+		}
+	}()
 
 	log.Printf("🚀 Webhook запущен на :8443 (HTTPS)")
 	log.Printf("📂 Использую сертификат: %s", certFile)
+	log.Printf("⚖️  Режим: %s, при ошибке разбора: %s", action, failure)
 
-	// Запуск сервера
-	server := &http.Server{Addr: ":8443"}
-	err := server.ListenAndServeTLS(certFile, keyFile)
-	if err != nil {
+	// Запуск сервера с таймаутами; по SIGTERM сначала /readyz отвечает 503, потом сервер дожидается текущих запросов
+	if err := server.Run(server.New(":8443", mux), certFile, keyFile, health); err != nil {
 		log.Fatalf("❌ КРИТИЧЕСКАЯ ОШИБКА: %v", err)
 	}
 }
@@ -1,107 +1,75 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 
-	admissionv1 "k8s.io/api/admission/v1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"admission"
+	"admission/metrics"
+	"admission/rules"
+	"admission/server"
 )
 
-// Handler for incoming requests from Kubernetes
-func handleValidate(w http.ResponseWriter, r *http.Request) {
-	var body []byte
-	if r.Body != nil {
-		if data, err := io.ReadAll(r.Body); err == nil {
-			body = data
-		}
-	}
-
-	if len(body) == 0 {
-		http.Error(w, "Empty request body", http.StatusBadRequest)
-		return
-	}
-
-	// Decode the AdmissionReview object from Kubernetes
-	var admissionReview admissionv1.AdmissionReview
-	if err := json.Unmarshal(body, &admissionReview); err != nil {
-		fmt.Printf("Parsing error: %v\n", err)
-		http.Error(w, "Parsing error", http.StatusBadRequest)
-		return
-	}
-
-	// Extract pod data from the request
-	raw := admissionReview.Request.Object.Raw
-	pod := corev1.Pod{}
-	if err := json.Unmarshal(raw, &pod); err != nil {
-		fmt.Printf("Error parsing pod: %v\n", err)
-	}
-
-	// SECURITY LOGIC (Charter)
-	allowed := true
-	message := "The Guard approves this pod."
-
-	// Check: Prohibit running privileged containers
-	for _, container := range pod.Spec.Containers {
-		if container.SecurityContext != nil && container.SecurityContext.Privileged != nil {
-			if *container.SecurityContext.Privileged {
-				allowed = false
-				message = "SECURITY ERROR: Privileged containers are prohibited by cluster law!"
-				break
-			}
-		}
-	}
+func main() {
+	// deny blocks the pod, warn lets it in with a kubectl warning, audit lets it in and only logs
+	actionName := flag.String("action", "deny", "What to do with privileged pods: deny, warn or audit")
+	metricsPort := flag.String("metrics-port", "9090", "Port for Prometheus /metrics (plain HTTP)")
+	// fail rejects pods the Guard can not read, ignore lets them in with a warning
+	failureName := flag.String("failure-policy", "fail", "What to do with objects that can not be decoded: fail or ignore")
+	flag.Parse()
 
-	// Build response for the API Server
-	response := admissionv1.AdmissionResponse{
-		UID:     admissionReview.Request.UID,
-		Allowed: allowed,
-		Result: &metav1.Status{
-			Message: message,
-		},
+	action, err := admission.ParseAction(*actionName)
+	if err != nil {
+		fmt.Printf("Invalid action: %v\n", err)
+		os.Exit(1)
 	}
-
-	// Send response back
-	admissionReview.Response = &response
-	res, err := json.Marshal(admissionReview)
+	failure, err := admission.ParseFailurePolicy(*failureName)
 	if err != nil {
-		fmt.Printf("Error marshalling response: %v\n", err)
-		http.Error(w, "Error marshalling response", http.StatusInternalServerError)
-		return
+		fmt.Printf("Invalid failure policy: %v\n", err)
+		os.Exit(1)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(res); err != nil {
-		fmt.Printf("Error writing response: %v\n", err)
-	}
-}
+	// SECURITY LOGIC (Charter): the Guard only prohibits privileged containers
+	guard := admission.NewHandler("sentinel", admission.Enforce(rules.Privileged(), action))
+	guard.SetFailurePolicy(failure)
 
-func main() {
-	// Route for Kubernetes
-	http.HandleFunc("/validate", handleValidate)
+	// Routes for Kubernetes: the review endpoint and the kubelet probes
+	health := &server.Health{}
+	mux := http.NewServeMux()
+	health.Register(mux)
+	mux.Handle("/validate", guard)
 
 	port := "8443"
 	// Webhook MUST use TLS (HTTPS)
 	certFile := "/etc/webhook/certs/tls.crt"
 	keyFile := "/etc/webhook/certs/tls.key"
 
-	fmt.Printf("Guard starting duty on port %s...\n", port)
+	fmt.Printf("Guard starting duty on port %s (action: %s, failure policy: %s)...\n", port, action, failure)
+
+	// Metrics live on their own port so scraping needs no TLS
+	if err := metrics.WatchCertificate("sentinel", certFile); err != nil {
+		fmt.Printf("WARNING: certificate expiry metric disabled: %v\n", err)
+	}
+	go func() {
+		if err := metrics.Serve(*metricsPort); err != nil {
+			fmt.Printf("Metrics server error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
 
-	// Check for certificate existence
+	// Check for certificate existence, Run serves plain HTTP without a certificate
 	if _, err := os.Stat(certFile); os.IsNotExist(err) {
 		fmt.Println("WARNING: Certificates not found, starting plain HTTP for testing (not for K8s)")
-		err := http.ListenAndServe(":"+port, nil)
-		if err != nil {
-			return
-		}
+		certFile, keyFile = "", ""
 	} else {
-		err := http.ListenAndServeTLS(":"+port, certFile, keyFile, nil)
-		if err != nil {
-			fmt.Printf("TLS startup error: %v\n", err)
-		}
+		health.AddCheck("certificate", server.CertificateFiles(certFile, keyFile))
+	}
+
+	// On SIGTERM /readyz fails first, then in-flight reviews are drained
+	if err := server.Run(server.New(":"+port, mux), certFile, keyFile, health); err != nil {
+		fmt.Printf("Server error: %v\n", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"admission"
+
+	"webhooklite/internal/check"
+	"webhooklite/internal/policy"
+)
+
+// Exit codes of webhooklite check
+const (
+	exitOK       = 0
+	exitRejected = 1
+	exitError    = 2
+)
+
+// files collects repeated -f flags
+type files []string
+
+func (f *files) String() string     { return strings.Join(*f, ",") }
+func (f *files) Set(v string) error { *f = append(*f, v); return nil }
+
+// runCheck is "webhooklite check": the /validate engine run against manifest files
+// instead of live admission requests.
+//
+//	webhooklite check -f sentinel/tests.yaml -f websecure/k8s/ -policy policy.yaml -o sarif
+func runCheck(args []string) int {
+	var paths files
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.Var(&paths, "f", "Manifest file or directory (YAML, multi-document YAML or JSON List), repeatable")
+	policyFile := fs.String("policy", "", "Policy file (YAML or JSON), the default built-in rules are enabled when empty")
+	output := fs.String("o", "text", "Output format: "+strings.Join(check.Formats, ", "))
+	namespace := fs.String("namespace", "default", "Namespace of objects that do not set one")
+	failOnName := fs.String("fail-on", "deny", "Mildest action that fails the check: deny, warn or audit")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ check needs at least one -f file or directory")
+		fs.Usage()
+		return exitError
+	}
+	failOn, err := admission.ParseAction(*failOnName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -fail-on: %v\n", err)
+		return exitError
+	}
+
+	compiled := policy.Default()
+	if *policyFile != "" {
+		if compiled, err = policy.Load(*policyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Invalid policy %s: %v\n", *policyFile, err)
+			return exitError
+		}
+	}
+
+	docs, loadErr := check.Load(paths)
+	validator := admission.NewHandler("webhooklite")
+	validator.SetPolicy(&compiled.Policy)
+	validator.SetNamespaceGetter(check.Namespaces(docs))
+
+	report := check.Run(validator, docs, *namespace)
+	if err := check.Write(os.Stdout, report, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	switch {
+	case loadErr != nil:
+		fmt.Fprintf(os.Stderr, "❌ %v\n", loadErr)
+		return exitError
+	case len(report.Errors) > 0:
+		return exitError
+	case report.Failed(failOn):
+		return exitRejected
+	}
+	return exitOK
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"admission"
+	"admission/metrics"
+	"admission/server"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"webhooklite/internal/audit"
+	"webhooklite/internal/certs"
+	"webhooklite/internal/kube"
+	"webhooklite/internal/policy"
+	"webhooklite/internal/policyreport"
+	"webhooklite/internal/recording"
+)
+
+type Config struct {
+	Port           string
+	MetricsPort    string
+	CertFile       string
+	KeyFile        string
+	PolicyFile     string
+	PolicyInterval time.Duration
+	CPULimit       string
+	MemoryLimit    string
+	FailurePolicy  string
+
+	// Self-managed TLS, see internal/certs
+	ManageCerts       bool
+	Namespace         string
+	CertSecret        string
+	Service           string
+	ValidatingWebhook string
+	MutatingWebhook   string
+	CertInterval      time.Duration
+
+	// Background audit of running pods, see internal/audit
+	AuditInterval time.Duration
+	AuditExcludes string
+
+	// PolicyReport output, see internal/policyreport
+	PolicyReports  bool
+	ReportInterval time.Duration
+	ReportTTL      time.Duration
+
+	// Recording of /validate traffic for webhooklite replay, see internal/recording
+	RecordFile    string
+	RecordMaxSize int64
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
+	cfg := Config{}
+	flag.StringVar(&cfg.Port, "port", "8443", "Port to serve the webhook on")
+	flag.StringVar(&cfg.MetricsPort, "metrics-port", "9090", "Port to serve Prometheus /metrics on (plain HTTP)")
+	flag.StringVar(&cfg.CertFile, "tls-cert", "/certs/tls.crt", "TLS certificate file")
+	flag.StringVar(&cfg.KeyFile, "tls-key", "/certs/tls.key", "TLS private key file")
+	flag.StringVar(&cfg.PolicyFile, "policy", "", "Policy file (YAML or JSON), the default built-in rules are enabled when empty")
+	flag.DurationVar(&cfg.PolicyInterval, "policy-interval", 10*time.Second, "How often the policy file is checked for changes")
+	flag.StringVar(&cfg.CPULimit, "default-cpu-limit", "500m", "CPU limit /mutate sets on containers without one")
+	flag.StringVar(&cfg.MemoryLimit, "default-memory-limit", "256Mi", "Memory limit /mutate sets on containers without one")
+	flag.StringVar(&cfg.FailurePolicy, "failure-policy", "fail", "What happens to objects that can not be decoded or reviewed: fail rejects them, ignore allows them with a warning")
+	flag.BoolVar(&cfg.ManageCerts, "manage-certs", false, "Generate, store and rotate the TLS certificate in a Secret instead of reading -tls-cert/-tls-key")
+	flag.StringVar(&cfg.Namespace, "namespace", envOr("POD_NAMESPACE", "webhook-system"), "Namespace of the webhook Service and certificate Secret")
+	flag.StringVar(&cfg.CertSecret, "cert-secret", "webhook-certs", "Secret that holds the CA and serving certificate")
+	flag.StringVar(&cfg.Service, "service", "webhook-service", "Service the API server calls, its DNS names go into the certificate")
+	flag.StringVar(&cfg.ValidatingWebhook, "validating-webhook", "webhook-validator", "ValidatingWebhookConfiguration whose caBundle is patched")
+	flag.StringVar(&cfg.MutatingWebhook, "mutating-webhook", "webhook-mutator", "MutatingWebhookConfiguration whose caBundle is patched")
+	flag.DurationVar(&cfg.CertInterval, "cert-interval", time.Hour, "How often the certificate and caBundles are checked")
+	flag.DurationVar(&cfg.AuditInterval, "audit-interval", 10*time.Minute, "How often running pods are audited against the policy, 0 disables the audit")
+	flag.StringVar(&cfg.AuditExcludes, "audit-exclude-namespaces", "webhook-system", "Comma-separated namespaces the audit skips")
+	flag.BoolVar(&cfg.PolicyReports, "policy-reports", false, "Write violations as PolicyReport/ClusterPolicyReport objects (needs the wgpolicyk8s.io CRDs)")
+	flag.DurationVar(&cfg.ReportInterval, "report-interval", 30*time.Second, "How often changed PolicyReports are written")
+	flag.DurationVar(&cfg.ReportTTL, "report-ttl", 24*time.Hour, "How long admission results stay in PolicyReports without the object being admitted again")
+	flag.StringVar(&cfg.RecordFile, "record", "", "Append sanitised AdmissionReviews and their decisions to this JSONL file, for webhooklite replay")
+	flag.Int64Var(&cfg.RecordMaxSize, "record-max-mb", 100, "Stop recording when the file reaches this many MiB, 0 means no limit")
+	flag.Parse()
+
+	defaults, err := parseDefaults(cfg)
+	if err != nil {
+		log.Fatalf("❌ Invalid default limits: %v", err)
+	}
+	failure, err := admission.ParseFailurePolicy(cfg.FailurePolicy)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	// Without a policy file webhooklite runs the default built-in rules. A policy file that is
+	// invalid or not mounted yet keeps the pod unready until the watch loads a valid version;
+	// until then the defaults answer, but the Service sends no traffic.
+	compiled := policy.Default()
+	var policyLoaded atomic.Bool
+	policyLoaded.Store(cfg.PolicyFile == "")
+	if cfg.PolicyFile != "" {
+		if loaded, err := policy.Load(cfg.PolicyFile); err != nil {
+			log.Printf("❌ Invalid policy %s, not ready until a valid version is mounted: %v", cfg.PolicyFile, err)
+		} else {
+			compiled = loaded
+			policyLoaded.Store(true)
+			log.Printf("📜 Policy loaded from %s", cfg.PolicyFile)
+		}
+	}
+
+	ctx := context.Background()
+	client, clientErr := kube.InCluster()
+
+	validator := admission.NewHandler("webhooklite")
+	validator.SetPolicy(&compiled.Policy)
+	validator.SetFailurePolicy(failure)
+	// CEL rules may read namespaceObject, it comes from a namespace informer
+	var namespaces admission.NamespaceGetter
+	if clientErr != nil {
+		log.Printf("⚠️  No in-cluster config, namespaceObject is not available to CEL rules: %v", clientErr)
+	} else {
+		namespaces = kube.Namespaces(ctx, client)
+		validator.SetNamespaceGetter(namespaces)
+	}
+
+	if cfg.RecordFile != "" {
+		recorder, err := recording.Create(cfg.RecordFile, cfg.RecordMaxSize<<20, namespaces)
+		if err != nil {
+			log.Fatalf("❌ Could not open recording %s: %v", cfg.RecordFile, err)
+		}
+		defer recorder.Close()
+		validator.AddRecorder(recorder.Record)
+		log.Printf("⏺️  Recording AdmissionReviews to %s", cfg.RecordFile)
+	}
+
+	// Ready once a policy is in place and a certificate is loaded, see admission/server
+	health := &server.Health{}
+	health.AddCheck("policy", func() error {
+		if !policyLoaded.Load() {
+			return fmt.Errorf("no valid policy loaded from %s yet", cfg.PolicyFile)
+		}
+		return nil
+	})
+
+	mux := http.NewServeMux()
+	health.Register(mux)
+	mux.Handle("/validate", validator)
+	mutator := admission.NewMutator("webhooklite", defaults)
+	mutator.SetFailurePolicy(failure)
+	mutator.SetExceptions(func() *admission.Exceptions { return validator.Policy().Exceptions })
+	mux.Handle("/mutate", mutator)
+
+	var reports *policyreport.Store
+	if cfg.PolicyReports {
+		if reports, err = startPolicyReports(ctx, cfg); err != nil {
+			log.Printf("⚠️  PolicyReports disabled: %v", err)
+		} else {
+			validator.AddRecorder(reports.Admitted)
+		}
+	}
+
+	// One pod informer serves the audit and drops the PolicyReport results of deleted pods
+	var pods kube.PodLister
+	if clientErr == nil && (cfg.AuditInterval > 0 || reports != nil) {
+		var onDelete func(namespace, name string)
+		if reports != nil {
+			onDelete = reports.PodDeleted
+		}
+		if pods, err = kube.Pods(ctx, client, onDelete); err != nil {
+			log.Fatalf("❌ Could not watch pods: %v", err)
+		}
+	}
+
+	// Pods that were admitted before a rule existed are only found by the audit
+	var scanner *audit.Scanner
+	switch {
+	case cfg.AuditInterval <= 0:
+	case clientErr != nil:
+		log.Printf("⚠️  No in-cluster config, running pods are not audited: %v", clientErr)
+	default:
+		scanner = &audit.Scanner{
+			Name:              "webhooklite",
+			Handler:           validator,
+			Pods:              pods,
+			ExcludeNamespaces: splitList(cfg.AuditExcludes),
+		}
+		if reports != nil {
+			scanner.OnReport = reports.Audited
+		}
+		mux.Handle("/audit", scanner)
+		go scanner.Run(ctx, cfg.AuditInterval)
+		log.Printf("🔎 Auditing running pods every %s, report on /audit", cfg.AuditInterval)
+	}
+
+	if cfg.PolicyFile != "" {
+		go policy.Watch(ctx, cfg.PolicyFile, cfg.PolicyInterval, func(c *policy.Compiled) {
+			validator.SetPolicy(&c.Policy)
+			policyLoaded.Store(true)
+			if scanner != nil {
+				scanner.Trigger()
+			}
+		})
+	}
+
+	srv := server.New(":"+cfg.Port, mux)
+
+	certFile, keyFile := cfg.CertFile, cfg.KeyFile
+	if cfg.ManageCerts {
+		if clientErr != nil {
+			log.Fatalf("❌ -manage-certs needs the in-cluster API: %v", clientErr)
+		}
+		manager := &certs.Manager{
+			Client:            client,
+			Namespace:         cfg.Namespace,
+			Secret:            cfg.CertSecret,
+			Service:           cfg.Service,
+			ValidatingWebhook: cfg.ValidatingWebhook,
+			MutatingWebhook:   cfg.MutatingWebhook,
+		}
+		// There is nothing to serve without a certificate; a caBundle that could not be
+		// patched yet is retried by Run. Replicas starting together race for the Secret,
+		// Reconcile reads the winner's certificate instead of failing.
+		reconcileErr := manager.Reconcile(ctx)
+		if _, err := manager.NotAfter(); err != nil {
+			log.Fatalf("❌ Could not set up the TLS certificate: %v", reconcileErr)
+		}
+		if reconcileErr != nil {
+			log.Printf("⚠️  %v", reconcileErr)
+		}
+		go manager.Run(ctx, cfg.CertInterval)
+
+		srv.TLSConfig = &tls.Config{GetCertificate: manager.GetCertificate}
+		certFile, keyFile = "", ""
+		health.AddCheck("certificate", func() error {
+			_, err := manager.NotAfter()
+			return err
+		})
+		if err := metrics.ObserveCertificate("webhooklite", manager.NotAfter); err != nil {
+			log.Printf("⚠️  Certificate expiry metric disabled: %v", err)
+		}
+		log.Printf("🔐 TLS certificate managed in Secret %s/%s", cfg.Namespace, cfg.CertSecret)
+	} else {
+		health.AddCheck("certificate", server.CertificateFiles(cfg.CertFile, cfg.KeyFile))
+		if err := metrics.WatchCertificate("webhooklite", cfg.CertFile); err != nil {
+			log.Printf("⚠️  Certificate expiry metric disabled: %v", err)
+		}
+	}
+	go func() {
+		if err := metrics.Serve(cfg.MetricsPort); err != nil {
+			log.Fatalf("❌ Metrics server error: %v", err)
+		}
+	}()
+
+	log.Printf("🚀 webhooklite started on :%s (HTTPS)", cfg.Port)
+	log.Printf("🔒 %d rules loaded: %v", len(compiled.RuleNames()), compiled.RuleNames())
+	if err := server.Run(srv, certFile, keyFile, health); err != nil {
+		log.Fatalf("❌ Server error: %v", err)
+	}
+}
+
+// envOr returns the environment variable or fallback when it is not set
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// startPolicyReports starts the writer and returns the store decisions are recorded in
+func startPolicyReports(ctx context.Context, cfg Config) (*policyreport.Store, error) {
+	client, err := kube.InClusterDynamic()
+	if err != nil {
+		return nil, err
+	}
+	store := policyreport.NewStore(cfg.ReportTTL)
+	writer := &policyreport.Writer{Client: client, Name: "webhooklite", Store: store}
+	go writer.Run(ctx, cfg.ReportInterval)
+	log.Printf("📋 Writing PolicyReports every %s", cfg.ReportInterval)
+	return store, nil
+}
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseDefaults(cfg Config) (admission.Defaults, error) {
+	cpu, err := resource.ParseQuantity(cfg.CPULimit)
+	if err != nil {
+		return admission.Defaults{}, err
+	}
+	memory, err := resource.ParseQuantity(cfg.MemoryLimit)
+	if err != nil {
+		return admission.Defaults{}, err
+	}
+	return admission.Defaults{CPULimit: cpu, MemoryLimit: memory}, nil
+}
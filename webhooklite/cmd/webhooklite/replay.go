@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"admission"
+
+	"webhooklite/internal/policy"
+	"webhooklite/internal/recording"
+)
+
+// runReplay is "webhooklite replay": a recording of /validate traffic decided again
+// with another policy, every decision that flipped is reported.
+//
+//	webhooklite replay -f reviews.jsonl -policy new-policy.yaml
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := fs.String("f", "", "Recording written by -record (JSONL)")
+	policyFile := fs.String("policy", "", "Policy file (YAML or JSON) to replay with, the default built-in rules are enabled when empty")
+	output := fs.String("o", "text", "Output format: "+strings.Join(recording.Formats, ", "))
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "❌ replay needs a -f recording")
+		fs.Usage()
+		return exitError
+	}
+
+	compiled := policy.Default()
+	var err error
+	if *policyFile != "" {
+		if compiled, err = policy.Load(*policyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Invalid policy %s: %v\n", *policyFile, err)
+			return exitError
+		}
+	}
+
+	records, readErr := recording.Read(*file)
+	validator := admission.NewHandler("webhooklite")
+	validator.SetPolicy(&compiled.Policy)
+	validator.SetNamespaceGetter(recording.Namespaces(records))
+
+	result := recording.Replay(validator, records)
+	if err := recording.Write(os.Stdout, result, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	switch {
+	case readErr != nil:
+		fmt.Fprintf(os.Stderr, "❌ %v\n", readErr)
+		return exitError
+	case len(result.Errors) > 0:
+		return exitError
+	case result.Flipped():
+		return exitRejected
+	}
+	return exitOK
+}
@@ -0,0 +1,246 @@
+// Package audit re-checks pods that are already running. Admission only sees new objects,
+// so pods created before a rule was added (or while the webhook was not called) are found here.
+// Every run evaluates all running pods against the policy the webhook currently enforces
+// and publishes a per-namespace summary over HTTP and as metrics.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"admission"
+	"admission/metrics"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"webhooklite/internal/kube"
+)
+
+// Username is the requesting user of the audit admission requests, CEL rules see it in request.userInfo
+const Username = "webhooklite-audit"
+
+// Finding is a violation of one running pod
+type Finding struct {
+	Pod string `json:"pod"`
+	// Owner is "Kind name" of the controller that created the pod, fix the violation there
+	Owner string `json:"owner,omitempty"`
+	admission.Violation
+}
+
+// Namespace is the audit summary of one namespace
+type Namespace struct {
+	Pods          int       `json:"pods"`
+	ViolatingPods int       `json:"violatingPods"`
+	Deny          int       `json:"deny"`
+	Warn          int       `json:"warn"`
+	Audit         int       `json:"audit"`
+	Findings      []Finding `json:"findings,omitempty"`
+}
+
+// Report is the result of one audit run
+type Report struct {
+	Finished   time.Time             `json:"finished"`
+	Duration   string                `json:"duration"`
+	Pods       int                   `json:"pods"`
+	Namespaces map[string]*Namespace `json:"namespaces"`
+	// Errors are pods the policy could not be evaluated for
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Scanner audits the running pods with the policy of Handler
+type Scanner struct {
+	Name    string
+	Handler *admission.Handler
+	Pods    kube.PodLister
+	// ExcludeNamespaces are not audited, like the namespaceSelector of the webhook configuration
+	ExcludeNamespaces []string
+	// OnReport, when set, gets every finished report, e.g. to write PolicyReports
+	OnReport func(*Report)
+
+	last    atomic.Pointer[Report]
+	trigger chan struct{}
+	once    sync.Once
+}
+
+// Run audits right away and then every interval until ctx is done
+func (s *Scanner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Scan(ctx); err != nil {
+			log.Printf("⚠️  [%s] Audit failed: %v", s.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.triggered():
+		}
+	}
+}
+
+// Trigger asks Run for an extra audit, e.g. after the policy was reloaded
+func (s *Scanner) Trigger() {
+	select {
+	case s.triggered() <- struct{}{}:
+	default:
+		// an audit is already pending
+	}
+}
+
+func (s *Scanner) triggered() chan struct{} {
+	s.once.Do(func() { s.trigger = make(chan struct{}, 1) })
+	return s.trigger
+}
+
+// Scan audits every running pod once and publishes the report
+func (s *Scanner) Scan(ctx context.Context) error {
+	start := time.Now()
+	pods, err := s.Pods(ctx)
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	report := &Report{Namespaces: make(map[string]*Namespace)}
+	for _, pod := range pods {
+		if !s.audited(pod) {
+			continue
+		}
+		ns := report.Namespaces[pod.Namespace]
+		if ns == nil {
+			ns = &Namespace{}
+			report.Namespaces[pod.Namespace] = ns
+		}
+		ns.Pods++
+		report.Pods++
+
+		decision, err := s.Handler.Decide(request(pod))
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		if len(decision.Violations) > 0 {
+			ns.ViolatingPods++
+		}
+		for _, v := range decision.Violations {
+			ns.Findings = append(ns.Findings, Finding{Pod: pod.Name, Owner: owner(pod), Violation: v})
+			switch v.Action {
+			case admission.ActionDeny:
+				ns.Deny++
+			case admission.ActionWarn:
+				ns.Warn++
+			case admission.ActionAudit:
+				ns.Audit++
+			}
+		}
+	}
+
+	report.Finished = time.Now()
+	took := report.Finished.Sub(start)
+	report.Duration = took.Round(time.Millisecond).String()
+	s.last.Store(report)
+	s.publish(report, took)
+	if s.OnReport != nil {
+		s.OnReport(report)
+	}
+
+	violating := 0
+	for _, ns := range report.Namespaces {
+		violating += ns.ViolatingPods
+	}
+	log.Printf("🔎 [%s] Audit: %d pods in %d namespaces, %d violating, %d errors (%s)",
+		s.Name, report.Pods, len(report.Namespaces), violating, len(report.Errors), report.Duration)
+	return nil
+}
+
+// Last returns the latest report, nil before the first audit finished
+func (s *Scanner) Last() *Report {
+	return s.last.Load()
+}
+
+// ServeHTTP returns the latest report as JSON; ?namespace= narrows it to one namespace
+func (s *Scanner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := s.Last()
+	if report == nil {
+		http.Error(w, "no audit has finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		filtered := *report
+		filtered.Namespaces = make(map[string]*Namespace)
+		if ns, ok := report.Namespaces[namespace]; ok {
+			filtered.Namespaces[namespace] = ns
+			filtered.Pods = ns.Pods
+		} else {
+			filtered.Pods = 0
+		}
+		report = &filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Printf("❌ [%s] Could not write the audit report: %v", s.Name, err)
+	}
+}
+
+// audited skips excluded namespaces and pods that are no longer running
+func (s *Scanner) audited(pod *corev1.Pod) bool {
+	if slices.Contains(s.ExcludeNamespaces, pod.Namespace) {
+		return false
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// publish exports the report as admission_audit_* metrics
+func (s *Scanner) publish(report *Report, took time.Duration) {
+	pods := make(map[string]int, len(report.Namespaces))
+	var counts []metrics.AuditCount
+	for name, ns := range report.Namespaces {
+		pods[name] = ns.Pods
+		byRule := make(map[[2]string]int)
+		for _, f := range ns.Findings {
+			byRule[[2]string{f.Rule, string(f.Action)}]++
+		}
+		for key, n := range byRule {
+			counts = append(counts, metrics.AuditCount{Namespace: name, Rule: key[0], Action: key[1], Count: n})
+		}
+	}
+	metrics.RecordAudit(s.Name, pods, counts, report.Finished, took)
+}
+
+// request presents a running pod to the policy as if it was created now
+func request(pod *corev1.Pod) *admissionv1.AdmissionRequest {
+	req := &admissionv1.AdmissionRequest{
+		UID:       types.UID("audit-" + string(pod.UID)),
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Operation: admissionv1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: Username},
+	}
+	pod = pod.DeepCopy()
+	pod.APIVersion, pod.Kind = "v1", "Pod"
+	// Marshalling a Pod can not fail
+	req.Object.Raw, _ = json.Marshal(pod)
+	return req
+}
+
+func owner(pod *corev1.Pod) string {
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		return ref.Kind + " " + ref.Name
+	}
+	return ""
+}
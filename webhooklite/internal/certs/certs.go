@@ -0,0 +1,236 @@
+// Package certs lets webhooklite run its own small PKI: a CA and a serving certificate kept in
+// a Secret, the CA published as caBundle of the webhook configurations, and the serving
+// certificate re-issued before it expires.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// Keys of the certificate Secret; tls.crt and tls.key make it a valid kubernetes.io/tls Secret
+const (
+	CertKey   = "tls.crt"
+	KeyKey    = "tls.key"
+	CAKey     = "ca.crt"
+	CAKeyKey  = "ca.key"
+	caSubject = "webhooklite-ca"
+)
+
+// bundle is the parsed content of the Secret
+type bundle struct {
+	// caPEM is the caBundle: the signing CA first, then a previous CA still trusted during rotation
+	caPEM    []byte
+	caKeyPEM []byte
+	certPEM  []byte
+	keyPEM   []byte
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+	leaf  *x509.Certificate
+	tls   tls.Certificate
+}
+
+// data is the bundle as Secret data
+func (b *bundle) data() map[string][]byte {
+	return map[string][]byte{
+		CertKey:  b.certPEM,
+		KeyKey:   b.keyPEM,
+		CAKey:    b.caPEM,
+		CAKeyKey: b.caKeyPEM,
+	}
+}
+
+// parseBundle reads a bundle back from Secret data
+func parseBundle(data map[string][]byte) (*bundle, error) {
+	b := &bundle{caPEM: data[CAKey], caKeyPEM: data[CAKeyKey], certPEM: data[CertKey], keyPEM: data[KeyKey]}
+
+	cas, err := parseCertificates(b.caPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", CAKey, err)
+	}
+	b.ca = cas[0]
+	if b.caKey, err = parseKey(b.caKeyPEM); err != nil {
+		return nil, fmt.Errorf("%s: %w", CAKeyKey, err)
+	}
+	if b.tls, err = tls.X509KeyPair(b.certPEM, b.keyPEM); err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", CertKey, KeyKey, err)
+	}
+	b.leaf = b.tls.Leaf
+	if b.leaf == nil {
+		if b.leaf, err = x509.ParseCertificate(b.tls.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.leaf.CheckSignatureFrom(b.ca); err != nil {
+		return nil, fmt.Errorf("%s is not signed by the CA: %w", CertKey, err)
+	}
+	return b, nil
+}
+
+// newCA creates a self-signed CA. previous, when still valid, stays in the caBundle
+// so the API server keeps trusting serving certificates of replicas that have not rotated yet.
+func newCA(now time.Time, validity time.Duration, previous *bundle) (*bundle, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: caSubject},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundle{ca: ca, caKey: key, caKeyPEM: keyPEM, caPEM: encodeCertificate(der)}
+	if previous != nil && previous.ca != nil && now.Before(previous.ca.NotAfter) {
+		b.caPEM = append(b.caPEM, encodeCertificate(previous.ca.Raw)...)
+	}
+	return b, nil
+}
+
+// dropExpiredCAs removes previous CAs that have expired from the caBundle, reporting whether any was dropped
+func (b *bundle) dropExpiredCAs(now time.Time) bool {
+	cas, err := parseCertificates(b.caPEM)
+	if err != nil {
+		return false
+	}
+	caPEM := encodeCertificate(cas[0].Raw)
+	for _, ca := range cas[1:] {
+		if now.Before(ca.NotAfter) {
+			caPEM = append(caPEM, encodeCertificate(ca.Raw)...)
+		}
+	}
+	if len(caPEM) == len(b.caPEM) {
+		return false
+	}
+	b.caPEM = caPEM
+	return true
+}
+
+// trustsNewerCA reports whether caBundle holds a webhooklite CA issued after the signing CA of caPEM
+func trustsNewerCA(caBundle, caPEM []byte) bool {
+	ours, err := parseCertificates(caPEM)
+	if err != nil {
+		return false
+	}
+	published, _ := parseCertificates(caBundle)
+	return slices.ContainsFunc(published, func(ca *x509.Certificate) bool {
+		return ca.IsCA && ca.Subject.CommonName == caSubject && ca.NotBefore.After(ours[0].NotBefore)
+	})
+}
+
+// issue signs a new serving certificate for dnsNames with the CA of b
+func (b *bundle) issue(now time.Time, validity time.Duration, dnsNames []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	notAfter := now.Add(validity)
+	if notAfter.After(b.ca.NotAfter) {
+		notAfter = b.ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, b.ca, &key.PublicKey, b.caKey)
+	if err != nil {
+		return err
+	}
+	if b.keyPEM, err = encodeKey(key); err != nil {
+		return err
+	}
+	b.certPEM = encodeCertificate(der)
+	if b.tls, err = tls.X509KeyPair(b.certPEM, b.keyPEM); err != nil {
+		return err
+	}
+	b.leaf, err = x509.ParseCertificate(der)
+	return err
+}
+
+// covers reports whether the serving certificate is valid for all dnsNames
+func (b *bundle) covers(dnsNames []string) bool {
+	for _, name := range dnsNames {
+		if !slices.Contains(b.leaf.DNSNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(fmt.Sprintf("crypto/rand: %v", err))
+	}
+	return serial
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate")
+	}
+	return certs, nil
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.New("no PEM EC private key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
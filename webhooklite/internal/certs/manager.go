@@ -0,0 +1,297 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Manager keeps the serving certificate in the Secret valid and the caBundle of the
+// webhook configurations in sync with it. Every replica runs one; they agree through
+// the Secret, so whoever writes it first wins and the others pick it up.
+type Manager struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Secret holds the CA and the serving certificate
+	Secret string
+	// Service is the webhook Service, its DNS names go into the serving certificate
+	Service string
+	// ValidatingWebhook and MutatingWebhook are the configurations whose caBundle is patched,
+	// only webhooks that point at Service are touched; empty names are skipped
+	ValidatingWebhook string
+	MutatingWebhook   string
+
+	CAValidity   time.Duration
+	CertValidity time.Duration
+	// RotateBefore is how long before expiry the serving certificate (or the CA) is replaced
+	RotateBefore time.Duration
+	// Now is time.Now unless a test fakes the clock
+	Now func() time.Time
+
+	current atomic.Pointer[bundle]
+}
+
+// Defaults for the zero values of Manager
+const (
+	DefaultCAValidity   = 10 * 365 * 24 * time.Hour
+	DefaultCertValidity = 365 * 24 * time.Hour
+	DefaultRotateBefore = 30 * 24 * time.Hour
+)
+
+// DNSNames are the names the API server may use to reach the Service
+func (m *Manager) DNSNames() []string {
+	svc := m.Service + "." + m.Namespace + ".svc"
+	return []string{svc, m.Service, m.Service + "." + m.Namespace, svc + ".cluster.local"}
+}
+
+// Reconcile makes sure the Secret holds a CA and a serving certificate that is valid beyond
+// RotateBefore, patches the caBundles and loads the certificate for serving. Rotating the serving
+// certificate keeps the CA, so the caBundle stays valid and in-flight connections are not affected.
+// A new CA is published next to the old one first; the certificate it signs is only served once both
+// caBundles trust it, and the old CA is dropped on a later round, once it has expired.
+// Losing the race for the Secret to another replica is not an error, its certificate is used instead.
+func (m *Manager) Reconcile(ctx context.Context) error {
+	var err error
+	for range 3 {
+		if err = m.reconcile(ctx); !errors.Is(err, errConflict) {
+			return err
+		}
+		log.Printf("🔐 %v, reading it again", err)
+	}
+	return err
+}
+
+// errConflict - the Secret or a caBundle changed since it was read
+var errConflict = errors.New("changed concurrently")
+
+func (m *Manager) reconcile(ctx context.Context) error {
+	now := m.now()
+	secrets := m.Client.CoreV1().Secrets(m.Namespace)
+
+	secret, err := secrets.Get(ctx, m.Secret, metav1.GetOptions{})
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return fmt.Errorf("get secret %s/%s: %w", m.Namespace, m.Secret, err)
+	}
+
+	var b *bundle
+	changed := notFound
+	if !notFound {
+		if b, err = parseBundle(secret.Data); err != nil {
+			log.Printf("🔐 Secret %s/%s is unusable, generating a new CA: %v", m.Namespace, m.Secret, err)
+			b, changed = nil, true
+		}
+	}
+	renewCA := b == nil || now.Add(m.rotateBefore()).After(b.ca.NotAfter)
+	if renewCA {
+		if b, err = newCA(now, m.caValidity(), b); err != nil {
+			return fmt.Errorf("generate CA: %w", err)
+		}
+		changed = true
+		log.Printf("🔐 New CA, valid until %s", b.ca.NotAfter.Format(time.RFC3339))
+	} else if b.dropExpiredCAs(now) {
+		changed = true
+		log.Printf("🔐 Expired CA dropped from the caBundle")
+	}
+	if renewCA || now.Add(m.rotateBefore()).After(b.leaf.NotAfter) || !b.covers(m.DNSNames()) {
+		if err := b.issue(now, m.certValidity(), m.DNSNames()); err != nil {
+			return fmt.Errorf("issue serving certificate: %w", err)
+		}
+		changed = true
+		log.Printf("🔐 New serving certificate for %v, valid until %s", m.DNSNames(), b.leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if changed {
+		if notFound {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: m.Secret, Namespace: m.Namespace},
+				Type:       corev1.SecretTypeTLS,
+				Data:       b.data(),
+			}
+			_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		} else {
+			secret.Data = b.data()
+			_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			return fmt.Errorf("secret %s/%s %w", m.Namespace, m.Secret, errConflict)
+		}
+		if err != nil {
+			return fmt.Errorf("store secret %s/%s: %w", m.Namespace, m.Secret, err)
+		}
+	}
+
+	// Serving a certificate the API server does not trust yet would fail every review, so a
+	// caBundle that could not be patched keeps the current certificate. Configurations that do
+	// not exist yet trust nothing either way and do not hold the switch back.
+	missing, err := m.patchCABundles(ctx, b.caPEM)
+	if err != nil && m.current.Load() != nil {
+		return fmt.Errorf("keeping the current certificate: %w", err)
+	}
+	m.current.Store(b)
+	return errors.Join(err, missing)
+}
+
+// retryInterval is used instead of the regular interval after a failed round,
+// e.g. while the webhook configurations have not been applied yet
+const retryInterval = 10 * time.Second
+
+// Run reconciles every interval until ctx is done; errors are logged and retried sooner
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			next := interval
+			if err := m.Reconcile(ctx); err != nil {
+				log.Printf("⚠️  Certificate reconcile failed: %v", err)
+				next = min(interval, retryInterval)
+			}
+			timer.Reset(next)
+		}
+	}
+}
+
+// GetCertificate is the tls.Config hook; the newest certificate is served without a restart
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	b := m.current.Load()
+	if b == nil {
+		return nil, errors.New("no serving certificate yet")
+	}
+	return &b.tls, nil
+}
+
+// NotAfter is the expiry of the certificate currently served
+func (m *Manager) NotAfter() (time.Time, error) {
+	b := m.current.Load()
+	if b == nil {
+		return time.Time{}, errors.New("no serving certificate yet")
+	}
+	return b.leaf.NotAfter, nil
+}
+
+// patchCABundles sets caBundle on our webhooks. Configurations that do not exist yet (they are
+// applied after the webhook is running) are returned as missing, so Run retries them soon.
+func (m *Manager) patchCABundles(ctx context.Context, caPEM []byte) (missing, err error) {
+	var missingErrs, errs []error
+	collect := func(err error) {
+		if errors.Is(err, errMissing) {
+			missingErrs = append(missingErrs, err)
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	admissionregistration := m.Client.AdmissionregistrationV1()
+	if m.ValidatingWebhook != "" {
+		configs := admissionregistration.ValidatingWebhookConfigurations()
+		collect(patchCABundle(ctx, m, caPEM, "ValidatingWebhookConfiguration", m.ValidatingWebhook, configs.Get, configs.Update,
+			func(config *admissionregistrationv1.ValidatingWebhookConfiguration) (clientConfigs []*admissionregistrationv1.WebhookClientConfig) {
+				for i := range config.Webhooks {
+					clientConfigs = append(clientConfigs, &config.Webhooks[i].ClientConfig)
+				}
+				return clientConfigs
+			}))
+	}
+	if m.MutatingWebhook != "" {
+		configs := admissionregistration.MutatingWebhookConfigurations()
+		collect(patchCABundle(ctx, m, caPEM, "MutatingWebhookConfiguration", m.MutatingWebhook, configs.Get, configs.Update,
+			func(config *admissionregistrationv1.MutatingWebhookConfiguration) (clientConfigs []*admissionregistrationv1.WebhookClientConfig) {
+				for i := range config.Webhooks {
+					clientConfigs = append(clientConfigs, &config.Webhooks[i].ClientConfig)
+				}
+				return clientConfigs
+			}))
+	}
+	return errors.Join(missingErrs...), errors.Join(errs...)
+}
+
+// errMissing - the webhook configuration has not been applied yet
+var errMissing = errors.New("does not exist yet")
+
+// patchCABundle reads one webhook configuration and writes it back if a caBundle of ours changed
+func patchCABundle[T any](ctx context.Context, m *Manager, caPEM []byte, kind, name string,
+	get func(context.Context, string, metav1.GetOptions) (T, error),
+	update func(context.Context, T, metav1.UpdateOptions) (T, error),
+	clientConfigs func(T) []*admissionregistrationv1.WebhookClientConfig,
+) error {
+	config, err := get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%s %s %w", kind, name, errMissing)
+	}
+	if err != nil {
+		return fmt.Errorf("get %s %s: %w", kind, name, err)
+	}
+	patched := false
+	for _, clientConfig := range clientConfigs(config) {
+		// A replica that read the Secret after us already published a newer CA, ours is stale
+		if m.ours(clientConfig) && trustsNewerCA(clientConfig.CABundle, caPEM) {
+			return fmt.Errorf("caBundle of %s %s %w", kind, name, errConflict)
+		}
+		patched = m.setCABundle(clientConfig, caPEM) || patched
+	}
+	if !patched {
+		return nil
+	}
+	if _, err := update(ctx, config, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update %s %s: %w", kind, name, err)
+	}
+	log.Printf("🔐 caBundle of %s %s updated", kind, name)
+	return nil
+}
+
+// setCABundle updates caBundle of a webhook that points at our Service, reporting whether it changed
+func (m *Manager) setCABundle(config *admissionregistrationv1.WebhookClientConfig, caPEM []byte) bool {
+	if !m.ours(config) || bytes.Equal(config.CABundle, caPEM) {
+		return false
+	}
+	config.CABundle = caPEM
+	return true
+}
+
+// ours reports whether the webhook points at our Service
+func (m *Manager) ours(config *admissionregistrationv1.WebhookClientConfig) bool {
+	svc := config.Service
+	return svc != nil && svc.Name == m.Service && svc.Namespace == m.Namespace
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *Manager) caValidity() time.Duration {
+	if m.CAValidity > 0 {
+		return m.CAValidity
+	}
+	return DefaultCAValidity
+}
+
+func (m *Manager) certValidity() time.Duration {
+	if m.CertValidity > 0 {
+		return m.CertValidity
+	}
+	return DefaultCertValidity
+}
+
+func (m *Manager) rotateBefore() time.Duration {
+	if m.RotateBefore > 0 {
+		return m.RotateBefore
+	}
+	return DefaultRotateBefore
+}
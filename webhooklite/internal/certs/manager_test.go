@@ -0,0 +1,208 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const namespace = "webhook-system"
+
+func newManager(client *fake.Clientset, now *time.Time) *Manager {
+	return &Manager{
+		Client:            client,
+		Namespace:         namespace,
+		Secret:            "webhook-certs",
+		Service:           "webhook-service",
+		ValidatingWebhook: "webhook-validator",
+		MutatingWebhook:   "webhook-mutator",
+		Now:               func() time.Time { return *now },
+	}
+}
+
+func webhookConfigs() []runtime.Object {
+	clientConfig := admissionregistrationv1.WebhookClientConfig{
+		Service: &admissionregistrationv1.ServiceReference{Name: "webhook-service", Namespace: namespace},
+	}
+	return []runtime.Object{
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-validator"},
+			Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "validate.security.lab", ClientConfig: clientConfig}},
+		},
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-mutator"},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "mutate.security.lab", ClientConfig: clientConfig}},
+		},
+	}
+}
+
+// caBundles returns the caBundle of the validating and the mutating webhook
+func caBundles(t *testing.T, client *fake.Clientset) (validating, mutating []byte) {
+	t.Helper()
+	ctx := context.Background()
+	v, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "webhook-validator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "webhook-mutator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.Webhooks[0].ClientConfig.CABundle, m.Webhooks[0].ClientConfig.CABundle
+}
+
+func served(t *testing.T, m *Manager) []byte {
+	t.Helper()
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func trusts(t *testing.T, caBundle, leafDER []byte) bool {
+	t.Helper()
+	cas, err := parseCertificates(caBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ca := range cas {
+		if leaf.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconcileCreatesSecretAndPublishesCA(t *testing.T) {
+	now := time.Now()
+	client := fake.NewClientset(webhookConfigs()...)
+	m := newManager(client, &now)
+
+	if err := m.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	secret, err := client.CoreV1().Secrets(namespace).Get(context.Background(), "webhook-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("secret not created: %v", err)
+	}
+	validating, mutating := caBundles(t, client)
+	if !bytes.Equal(validating, secret.Data[CAKey]) || !bytes.Equal(mutating, secret.Data[CAKey]) {
+		t.Error("caBundles do not match ca.crt of the Secret")
+	}
+	if !trusts(t, validating, served(t, m)) {
+		t.Error("served certificate is not signed by the published CA")
+	}
+}
+
+func TestCARotationServesNewCertificateOnlyOnceTrusted(t *testing.T) {
+	now := time.Now()
+	client := fake.NewClientset(webhookConfigs()...)
+	m := newManager(client, &now)
+	ctx := context.Background()
+	if err := m.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	before := served(t, m)
+
+	// The CA is about to expire and the mutating configuration can not be updated
+	now = now.Add(DefaultCAValidity - DefaultRotateBefore + time.Hour)
+	failing := true
+	client.PrependReactor("update", "mutatingwebhookconfigurations", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if failing {
+			return true, nil, errors.New("etcd unavailable")
+		}
+		return false, nil, nil
+	})
+	if err := m.Reconcile(ctx); err == nil {
+		t.Fatal("Reconcile succeeded although a caBundle could not be patched")
+	}
+	if !bytes.Equal(served(t, m), before) {
+		t.Fatal("switched to a certificate the API server does not trust yet")
+	}
+
+	failing = false
+	if err := m.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	after := served(t, m)
+	if bytes.Equal(after, before) {
+		t.Fatal("serving certificate not switched after the caBundle was published")
+	}
+	validating, mutating := caBundles(t, client)
+	for _, caBundle := range [][]byte{validating, mutating} {
+		if !trusts(t, caBundle, before) || !trusts(t, caBundle, after) {
+			t.Error("caBundle must trust the old and the new CA during the rotation")
+		}
+	}
+
+	// Once the old CA has expired it is dropped on the next round
+	now = now.Add(DefaultRotateBefore)
+	if err := m.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	validating, mutating = caBundles(t, client)
+	for _, caBundle := range [][]byte{validating, mutating} {
+		if trusts(t, caBundle, before) {
+			t.Error("expired CA still in the caBundle")
+		}
+		if !trusts(t, caBundle, after) {
+			t.Error("current CA missing from the caBundle")
+		}
+	}
+}
+
+func TestReconcileUsesSecretOfReplicaThatWonTheRace(t *testing.T) {
+	now := time.Now()
+	other := fake.NewClientset(webhookConfigs()...)
+	if err := newManager(other, &now).Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	winner, err := other.CoreV1().Secrets(namespace).Get(context.Background(), "webhook-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The Secret does not exist when this replica looks, the other one creates it just before us
+	client := fake.NewClientset(webhookConfigs()...)
+	client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if err := client.Tracker().Add(winner.DeepCopy()); err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewAlreadyExists(corev1.Resource("secrets"), "webhook-certs")
+	})
+	m := newManager(client, &now)
+	if err := m.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile after losing the race: %v", err)
+	}
+	if !bytes.Equal(m.current.Load().certPEM, winner.Data[CertKey]) {
+		t.Error("not serving the certificate of the replica that created the Secret")
+	}
+}
+
+func TestMissingWebhookConfigurationDoesNotBlockServing(t *testing.T) {
+	now := time.Now()
+	client := fake.NewClientset(webhookConfigs()[0])
+	m := newManager(client, &now)
+
+	err := m.Reconcile(context.Background())
+	if !errors.Is(err, errMissing) {
+		t.Fatalf("Reconcile = %v, want the missing mutating configuration reported", err)
+	}
+	served(t, m)
+}
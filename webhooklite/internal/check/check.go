@@ -0,0 +1,145 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Username is the requesting user of the offline admission requests
+const Username = "webhooklite-check"
+
+// Finding is a violation of one object
+type Finding struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	admission.Violation
+}
+
+// Object is "Kind namespace/name" like in the webhook logs
+func (f Finding) Object() string {
+	if f.Namespace == "" {
+		return fmt.Sprintf("%s %s", f.Kind, f.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", f.Kind, f.Namespace, f.Name)
+}
+
+// Report is the result of checking a set of manifests
+type Report struct {
+	Checked  int
+	Findings []Finding
+	// Errors are objects the webhook could not decode, the API server would reject them too
+	Errors []error
+}
+
+// Count returns how many findings have the action
+func (r *Report) Count(action admission.Action) int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed reports whether the manifests would be rejected. failOn is the mildest
+// action that fails the check: deny only fails on denials, audit fails on anything.
+func (r *Report) Failed(failOn admission.Action) bool {
+	failing := admission.Actions[:slices.Index(admission.Actions, failOn)+1]
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool {
+		return slices.Contains(failing, f.Action)
+	})
+}
+
+// Run sends every document through the handler as a CREATE request.
+// Objects without a namespace go to namespace, as kubectl apply would do.
+func Run(handler *admission.Handler, docs []Document, namespace string) *Report {
+	report := &Report{}
+	for i, doc := range docs {
+		if doc.Namespace == "" && !isClusterScoped(doc) {
+			doc.Namespace = namespace
+		}
+		req := &admissionv1.AdmissionRequest{
+			UID:       types.UID(fmt.Sprintf("check-%d", i)),
+			Kind:      metav1.GroupVersionKind{Group: doc.GVK.Group, Version: doc.GVK.Version, Kind: doc.GVK.Kind},
+			Name:      doc.Name,
+			Namespace: doc.Namespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: Username},
+		}
+		req.Object.Raw = doc.Object
+
+		decision, err := handler.Decide(req)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("%s:%d: %w", doc.File, doc.Line, err))
+			continue
+		}
+		if decision.Skipped {
+			continue
+		}
+		report.Checked++
+
+		finding := Finding{File: doc.File, Line: doc.Line, Kind: doc.GVK.Kind, Namespace: doc.Namespace, Name: doc.Name}
+		if decision.ExceptionError != nil {
+			finding.Violation = admission.Violation{
+				Rule:     admission.ExemptAnnotation,
+				Severity: admission.SeverityLow,
+				Action:   admission.ActionWarn,
+				Message:  fmt.Sprintf("ignored: %v", decision.ExceptionError),
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+		for _, v := range decision.Violations {
+			finding.Violation = v
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+	return report
+}
+
+// clusterScoped are the built-in kinds that never get a namespace.
+// Offline there is no API discovery to ask, everything else is treated as namespaced.
+var clusterScoped = []string{
+	"Namespace", "Node", "PersistentVolume", "ClusterRole", "ClusterRoleBinding",
+	"StorageClass", "PriorityClass", "RuntimeClass", "IngressClass", "CustomResourceDefinition",
+	"ValidatingWebhookConfiguration", "MutatingWebhookConfiguration",
+	"ValidatingAdmissionPolicy", "ValidatingAdmissionPolicyBinding",
+}
+
+func isClusterScoped(doc Document) bool {
+	return slices.Contains(clusterScoped, doc.GVK.Kind)
+}
+
+// Namespaces serves namespaceObject to CEL rules from the Namespace objects among the manifests
+func Namespaces(docs []Document) admission.NamespaceGetter {
+	namespaces := make(map[string]*corev1.Namespace)
+	for _, doc := range docs {
+		if doc.GVK.Group != "" || doc.GVK.Kind != "Namespace" {
+			continue
+		}
+		ns := &corev1.Namespace{}
+		if err := json.Unmarshal(doc.Object, ns); err == nil {
+			namespaces[ns.Name] = ns
+		}
+	}
+	return func(_ context.Context, name string) (*corev1.Namespace, error) {
+		if ns, ok := namespaces[name]; ok {
+			return ns, nil
+		}
+		return nil, apierrors.NewNotFound(corev1.Resource("namespaces"), name)
+	}
+}
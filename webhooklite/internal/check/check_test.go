@@ -0,0 +1,82 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"admission"
+
+	"webhooklite/internal/policy"
+)
+
+const namespacePolicy = `
+defaultAction: deny
+celRules:
+  - name: team-label-in-prod
+    action: audit
+    matchConditions:
+      - name: production-namespaces
+        expression: "namespaceObject != null && namespaceObject.metadata.?labels.env.orValue('') == 'prod'"
+    validations:
+      - expression: "has(object.metadata.labels) && 'team' in object.metadata.labels"
+        message: objects in production namespaces need a team label
+`
+
+const manifests = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: shop
+  labels:
+    env: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: in-prod
+  namespace: shop
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: labelled
+  namespace: shop
+  labels:
+    team: payments
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: elsewhere
+`
+
+func TestRunNamespaceObject(t *testing.T) {
+	compiled, err := policy.Parse([]byte(namespacePolicy))
+	if err != nil {
+		t.Fatalf("policy: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "manifests.yaml")
+	if err := os.WriteFile(file, []byte(manifests), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := Load([]string{file})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	handler := admission.NewHandler("test")
+	handler.SetPolicy(&compiled.Policy)
+	handler.SetNamespaceGetter(Namespaces(docs))
+	// "elsewhere" lands in default, which is not among the manifests
+	report := Run(handler, docs, "default")
+
+	if len(report.Errors) > 0 {
+		t.Fatalf("errors: %v", report.Errors)
+	}
+	if len(report.Findings) != 1 {
+		t.Fatalf("findings %+v, want only the unlabelled ConfigMap in shop", report.Findings)
+	}
+	if f := report.Findings[0]; f.Name != "in-prod" || f.Rule != "team-label-in-prod" || f.Action != admission.ActionAudit {
+		t.Errorf("finding %+v, want team-label-in-prod audit on in-prod", f)
+	}
+}
@@ -0,0 +1,178 @@
+// Package check runs the admission policy offline against manifest files,
+// with the same engine the /validate handler uses.
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// Document is one Kubernetes object read from a manifest file.
+// Items of a List share the line of the List.
+type Document struct {
+	File      string
+	Line      int
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	// Object is the object as JSON, the way the API server sends it to the webhook
+	Object []byte
+}
+
+// manifestExtensions are the files Load picks up when walking a directory
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// Load reads every manifest in the given files and directories.
+// Directories are walked recursively; all problems are reported at once.
+func Load(paths []string) ([]Document, error) {
+	var docs []Document
+	var errs []error
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// Files named explicitly are read whatever their extension
+			if file != path && !hasManifestExtension(file) {
+				return nil
+			}
+			found, err := loadFile(file)
+			docs = append(docs, found...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return docs, errors.Join(errs...)
+}
+
+func hasManifestExtension(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, e := range manifestExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFile splits a file into YAML documents (JSON is valid YAML) and expands Lists
+func loadFile(file string) ([]Document, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []Document
+	var errs []error
+	for _, chunk := range splitDocuments(data) {
+		raw, err := yaml.YAMLToJSON(chunk.data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", file, chunk.line, err))
+			continue
+		}
+		if t := bytes.TrimSpace(raw); len(t) == 0 || bytes.Equal(t, []byte("null")) {
+			continue
+		}
+		found, err := documents(file, chunk.line, raw)
+		docs = append(docs, found...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return docs, errors.Join(errs...)
+}
+
+type chunk struct {
+	line int
+	data []byte
+}
+
+// splitDocuments cuts a multi-document YAML file at "---" lines and remembers where each document starts
+func splitDocuments(data []byte) []chunk {
+	var chunks []chunk
+	current := chunk{line: 1}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, []byte("---")) && len(bytes.TrimSpace(line[3:])) == 0 {
+			chunks = append(chunks, current)
+			current = chunk{line: n + 1}
+			continue
+		}
+		if len(current.data) == 0 && len(bytes.TrimSpace(line)) == 0 {
+			// Start the document at its first non blank line
+			current.line = n + 1
+			continue
+		}
+		current.data = append(current.data, line...)
+		current.data = append(current.data, '\n')
+	}
+	return append(chunks, current)
+}
+
+type object struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name         string `json:"name"`
+		GenerateName string `json:"generateName"`
+		Namespace    string `json:"namespace"`
+	} `json:"metadata"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// documents turns one decoded document into objects, the items of a List become separate objects
+func documents(file string, line int, raw []byte) ([]Document, error) {
+	var obj object
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+	}
+	if obj.APIVersion == "" || obj.Kind == "" {
+		return nil, fmt.Errorf("%s:%d: not a Kubernetes object, apiVersion and kind are required", file, line)
+	}
+
+	if strings.HasSuffix(obj.Kind, "List") && obj.Items != nil {
+		var docs []Document
+		var errs []error
+		for _, item := range obj.Items {
+			found, err := documents(file, line, item)
+			docs = append(docs, found...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return docs, errors.Join(errs...)
+	}
+
+	name := obj.Metadata.Name
+	if name == "" && obj.Metadata.GenerateName != "" {
+		name = obj.Metadata.GenerateName + "*"
+	}
+	return []Document{{
+		File:      file,
+		Line:      line,
+		GVK:       schema.FromAPIVersionAndKind(obj.APIVersion, obj.Kind),
+		Namespace: obj.Metadata.Namespace,
+		Name:      name,
+		Object:    raw,
+	}}, nil
+}
@@ -0,0 +1,158 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"admission"
+)
+
+// Formats the report can be written in
+var Formats = []string{"text", "json", "sarif"}
+
+// Write prints the report in one of Formats
+func Write(w io.Writer, report *Report, format string) error {
+	switch format {
+	case "text":
+		return writeText(w, report)
+	case "json":
+		return writeJSON(w, report)
+	case "sarif":
+		return writeSARIF(w, report)
+	default:
+		return fmt.Errorf("unknown format %q (supported: %v)", format, Formats)
+	}
+}
+
+func writeText(w io.Writer, report *Report) error {
+	for _, f := range report.Findings {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s: %s %s\n", f.File, f.Line, f.Object(), f.Action, f.Violation); err != nil {
+			return err
+		}
+	}
+	for _, err := range report.Errors {
+		if _, err := fmt.Fprintf(w, "%v\n", err); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d objects checked: %d deny, %d warn, %d audit, %d errors\n",
+		report.Checked, report.Count(admission.ActionDeny), report.Count(admission.ActionWarn),
+		report.Count(admission.ActionAudit), len(report.Errors))
+	return err
+}
+
+type jsonReport struct {
+	Checked  int       `json:"checked"`
+	Findings []Finding `json:"findings"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+func writeJSON(w io.Writer, report *Report) error {
+	out := jsonReport{Checked: report.Checked, Findings: report.Findings}
+	if out.Findings == nil {
+		out.Findings = []Finding{}
+	}
+	for _, err := range report.Errors {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// SARIF 2.1.0, the subset code scanning tools read
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID         string         `json:"id"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifLevels maps enforcement actions to SARIF result levels
+var sarifLevels = map[admission.Action]string{
+	admission.ActionDeny:  "error",
+	admission.ActionWarn:  "warning",
+	admission.ActionAudit: "note",
+}
+
+func writeSARIF(w io.Writer, report *Report) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "webhooklite", Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	seen := make(map[string]bool)
+	for _, f := range report.Findings {
+		if !seen[f.Rule] {
+			seen[f.Rule] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:         f.Rule,
+				Properties: map[string]any{"severity": f.Severity},
+			})
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  f.Rule,
+			Level:   sarifLevels[f.Action],
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", f.Object(), f.Message)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact{URI: filepath.ToSlash(f.File)},
+				Region:           sarifRegion{StartLine: f.Line},
+			}}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
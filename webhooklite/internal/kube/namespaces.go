@@ -0,0 +1,51 @@
+// Package kube talks to the API server the webhook runs in
+package kube
+
+import (
+	"context"
+	"time"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// InCluster returns a client using the pod's service account
+func InCluster() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// InClusterDynamic returns a dynamic client, for resources without typed clients such as PolicyReports
+func InClusterDynamic() (dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+// Namespaces serves namespace lookups from an informer cache so admission requests
+// do not wait on the API server. Until the cache has synced it asks the API server directly.
+func Namespaces(ctx context.Context, client kubernetes.Interface) admission.NamespaceGetter {
+	factory := informers.NewSharedInformerFactory(client, 10*time.Minute)
+	informer := factory.Core().V1().Namespaces()
+	lister := informer.Lister()
+	synced := informer.Informer().HasSynced
+	factory.Start(ctx.Done())
+
+	return func(ctx context.Context, name string) (*corev1.Namespace, error) {
+		if synced() {
+			return lister.Get(name)
+		}
+		return client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	}
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodLister lists every pod in the cluster
+type PodLister func(ctx context.Context) ([]*corev1.Pod, error)
+
+// Pods lists pods from an informer cache, so a background audit does not load the
+// API server with a full list on every run. Until the cache has synced it lists directly.
+// onDelete, when not nil, is called with every pod the informer sees deleted.
+func Pods(ctx context.Context, client kubernetes.Interface, onDelete func(namespace, name string)) (PodLister, error) {
+	factory := informers.NewSharedInformerFactory(client, 10*time.Minute)
+	informer := factory.Core().V1().Pods()
+	lister := informer.Lister()
+	synced := informer.Informer().HasSynced
+	if onDelete != nil {
+		_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj any) {
+				// A delete missed during a relist arrives as a tombstone
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if pod, ok := obj.(*corev1.Pod); ok {
+					onDelete(pod.Namespace, pod.Name)
+				}
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	factory.Start(ctx.Done())
+
+	return func(ctx context.Context) ([]*corev1.Pod, error) {
+		if synced() {
+			return lister.List(labels.Everything())
+		}
+		list, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		pods := make([]*corev1.Pod, len(list.Items))
+		for i := range list.Items {
+			pods[i] = &list.Items[i]
+		}
+		return pods, nil
+	}, nil
+}
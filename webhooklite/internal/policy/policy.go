@@ -0,0 +1,277 @@
+// Package policy loads the webhooklite policy file: which rules are enabled,
+// their params and what happens when they are violated.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"admission"
+	"admission/ceilings"
+	"admission/celrules"
+	"admission/cosign"
+	"admission/podsecurity"
+	"admission/rules"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Policy is the YAML/JSON document mounted from the webhooklite-policy ConfigMap.
+//
+//	defaultAction: deny
+//	rules:
+//	  - name: allowed-registries
+//	    action: deny
+//	    params:
+//	      registries: ["docker.io", "ghcr.io"]
+//	  - name: no-latest-tag
+//	    action: warn
+//	  - name: resource-limits
+//	    enabled: false
+//	celRules:
+//	  - name: replicas-limit
+//	    action: warn
+//	    matchConditions:
+//	      - name: deployments
+//	        expression: request.kind.kind == 'Deployment'
+//	    validations:
+//	      - expression: object.spec.replicas <= 5
+//	        message: at most 5 replicas
+//	podSecurity:
+//	  defaultLevel: baseline
+//	  exemptNamespaces: ["kube-system"]
+//	imageSignatures:
+//	  action: deny
+//	  images:
+//	    - pattern: "ghcr.io/cooler-sai/**"
+//	      keys: ["-----BEGIN PUBLIC KEY-----\n..."]
+//	resourceCeilings:
+//	  ceilings:
+//	    - namespaceSelector:
+//	        matchLabels: {tier: team}
+//	      maxContainerLimits: {memory: 8Gi}
+//	      maxLimitRequestRatio: {memory: "2"}
+//	exceptions:
+//	  allowedNamespaces: ["kube-system"]
+//	  maxDays: 90
+type Policy struct {
+	// DefaultAction applies to rules without their own action: deny, warn or audit
+	DefaultAction string       `json:"defaultAction,omitempty"`
+	Rules         []RuleConfig `json:"rules"`
+	// CELRules run on every object the webhook is registered for, not only pods
+	CELRules []CELRuleConfig `json:"celRules,omitempty"`
+	// CELCostLimit bounds a single CEL evaluation, 0 means celrules.DefaultCostLimit
+	CELCostLimit uint64 `json:"celCostLimit,omitempty"`
+	// PodSecurity enforces the Pod Security Standards level of the pod-security.kubernetes.io namespace labels
+	PodSecurity *podsecurity.Config `json:"podSecurity,omitempty"`
+	// ImageSignatures requires cosign signatures on images matching its patterns
+	ImageSignatures *ImageSignaturesConfig `json:"imageSignatures,omitempty"`
+	// ResourceCeilings caps container and pod limits in the namespaces its selectors match
+	ResourceCeilings *ResourceCeilingsConfig `json:"resourceCeilings,omitempty"`
+	// Exceptions lists the namespaces where the security.lab/exempt annotation is honoured
+	Exceptions *admission.Exceptions `json:"exceptions,omitempty"`
+}
+
+// RuleConfig configures a single built-in rule
+type RuleConfig struct {
+	Name    string          `json:"name"`
+	Enabled *bool           `json:"enabled,omitempty"`
+	Action  string          `json:"action,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// CELRuleConfig is a custom rule written in CEL
+type CELRuleConfig struct {
+	celrules.Config `json:",inline"`
+	Enabled         *bool  `json:"enabled,omitempty"`
+	Action          string `json:"action,omitempty"`
+}
+
+// ImageSignaturesConfig configures the image-signatures rule
+type ImageSignaturesConfig struct {
+	cosign.Config `json:",inline"`
+	Action        string `json:"action,omitempty"`
+}
+
+// ResourceCeilingsConfig configures the resource-ceilings rule
+type ResourceCeilingsConfig struct {
+	ceilings.Config `json:",inline"`
+	Action          string `json:"action,omitempty"`
+}
+
+// IsEnabled - rules listed in the policy are enabled unless they say otherwise
+func (c RuleConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// IsEnabled - CEL rules are enabled unless they say otherwise
+func (c CELRuleConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// Compiled is a validated policy ready to be handed to the admission handler
+type Compiled struct {
+	admission.Policy
+}
+
+// Default enables the built-in rules that are not opt-in with their default params, honours the Pod Security
+// namespace labels and grants no exceptions
+func Default() *Compiled {
+	pss, err := podsecurity.New(podsecurity.Config{})
+	if err != nil {
+		panic(fmt.Sprintf("pod security defaults: %v", err))
+	}
+	return &Compiled{Policy: admission.Policy{
+		Rules:       rules.Builtin().Rules(),
+		ObjectRules: []admission.ObjectRule{pss},
+	}}
+}
+
+// Load reads, parses and compiles a policy file
+func Load(path string) (*Compiled, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and compiles a policy document, YAML or JSON
+func Parse(data []byte) (*Compiled, error) {
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	return p.Compile()
+}
+
+// Compile validates the policy and builds its rules.
+// All problems are reported at once so a broken ConfigMap can be fixed in one go.
+func (p *Policy) Compile() (*Compiled, error) {
+	if len(p.Rules) == 0 && len(p.CELRules) == 0 && p.PodSecurity == nil && p.ImageSignatures == nil && p.ResourceCeilings == nil {
+		return nil, errors.New("policy has no rules")
+	}
+
+	var errs []error
+	defaultAction, err := admission.ParseAction(p.DefaultAction)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("defaultAction: %w", err))
+	}
+
+	if p.Exceptions != nil {
+		if len(p.Exceptions.AllowedNamespaces) == 0 {
+			errs = append(errs, errors.New("exceptions: allowedNamespaces must not be empty"))
+		}
+		if p.Exceptions.MaxDays < 0 {
+			errs = append(errs, errors.New("exceptions: maxDays must not be negative"))
+		}
+	}
+
+	compiled := &Compiled{Policy: admission.Policy{Exceptions: p.Exceptions}}
+	if p.PodSecurity != nil {
+		// The enforce label always denies, warn and audit labels bring their own action
+		if rule, err := podsecurity.New(*p.PodSecurity); err != nil {
+			errs = append(errs, fmt.Errorf("podSecurity: %w", err))
+		} else {
+			compiled.ObjectRules = append(compiled.ObjectRules, rule)
+		}
+	}
+	seen := make(map[string]bool)
+	if cfg := p.ImageSignatures; cfg != nil {
+		seen[cosign.Name] = true
+		action := defaultAction
+		if cfg.Action != "" {
+			if action, err = admission.ParseAction(cfg.Action); err != nil {
+				errs = append(errs, fmt.Errorf("imageSignatures: %w", err))
+			}
+		}
+		if rule, err := cosign.New(cfg.Config, nil); err != nil {
+			errs = append(errs, fmt.Errorf("imageSignatures: %w", err))
+		} else {
+			compiled.Rules = append(compiled.Rules, admission.Enforce(rule, action))
+		}
+	}
+	if cfg := p.ResourceCeilings; cfg != nil {
+		seen[ceilings.Name] = true
+		action := defaultAction
+		if cfg.Action != "" {
+			if action, err = admission.ParseAction(cfg.Action); err != nil {
+				errs = append(errs, fmt.Errorf("resourceCeilings: %w", err))
+			}
+		}
+		if rule, err := ceilings.New(cfg.Config); err != nil {
+			errs = append(errs, fmt.Errorf("resourceCeilings: %w", err))
+		} else {
+			compiled.ObjectRules = append(compiled.ObjectRules, admission.EnforceObject(rule, action))
+		}
+	}
+	for i, cfg := range p.Rules {
+		if cfg.Name == "" {
+			errs = append(errs, fmt.Errorf("rules[%d]: name is required", i))
+			continue
+		}
+		if seen[cfg.Name] {
+			errs = append(errs, fmt.Errorf("rules[%d]: rule %q is listed twice", i, cfg.Name))
+			continue
+		}
+		seen[cfg.Name] = true
+
+		action := defaultAction
+		if cfg.Action != "" {
+			if action, err = admission.ParseAction(cfg.Action); err != nil {
+				errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+				continue
+			}
+		}
+		rule, err := rules.New(cfg.Name, cfg.Params)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+			continue
+		}
+		if cfg.IsEnabled() {
+			compiled.Rules = append(compiled.Rules, admission.Enforce(rule, action))
+		}
+	}
+
+	for i, cfg := range p.CELRules {
+		if cfg.Name != "" && seen[cfg.Name] {
+			errs = append(errs, fmt.Errorf("celRules[%d]: rule %q is listed twice", i, cfg.Name))
+			continue
+		}
+		seen[cfg.Name] = true
+
+		action := defaultAction
+		if cfg.Action != "" {
+			if action, err = admission.ParseAction(cfg.Action); err != nil {
+				errs = append(errs, fmt.Errorf("celRules[%d]: %w", i, err))
+				continue
+			}
+		}
+		rule, err := celrules.Compile(cfg.Config, p.CELCostLimit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("celRules[%d] %q: %w", i, cfg.Name, err))
+			continue
+		}
+		if cfg.IsEnabled() {
+			compiled.ObjectRules = append(compiled.ObjectRules, admission.EnforceObject(rule, action))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// RuleNames lists the enabled rules with their action, for logging
+func (c *Compiled) RuleNames() []string {
+	names := make([]string, 0, len(c.Rules)+len(c.ObjectRules))
+	for _, rule := range c.Rules {
+		names = append(names, fmt.Sprintf("%s=%s", rule.Name(), admission.ActionOf(rule)))
+	}
+	for _, rule := range c.ObjectRules {
+		names = append(names, fmt.Sprintf("%s=%s", rule.Name(), admission.ActionOf(rule)))
+	}
+	return names
+}
@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"time"
+)
+
+// Watch polls the policy file and calls apply with every new valid version.
+// Polling is used instead of inotify because ConfigMap volumes are updated by
+// swapping a symlink, which file watchers easily miss.
+// An invalid version is logged and skipped, the last good policy keeps serving.
+func Watch(ctx context.Context, path string, interval time.Duration, apply func(*Compiled)) {
+	last := fileHash(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		hash := fileHash(path)
+		if hash == nil || bytes.Equal(hash, last) {
+			continue
+		}
+		last = hash
+
+		compiled, err := Load(path)
+		if err != nil {
+			log.Printf("❌ Policy reload rejected, keeping the last good policy: %v", err)
+			continue
+		}
+		apply(compiled)
+		log.Printf("🔄 Policy reloaded from %s: %v", path, compiled.RuleNames())
+	}
+}
+
+// fileHash returns nil if the file can not be read (e.g. in the middle of a ConfigMap update)
+func fileHash(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,253 @@
+// Package policyreport publishes violations as PolicyReport and ClusterPolicyReport objects
+// (wgpolicyk8s.io/v1alpha2, from the Kubernetes policy working group) so dashboards
+// can show compliance without parsing webhook logs.
+//
+// There is one report per namespace plus one cluster report, all named after the webhook,
+// with one result per rule and resource. Results come from two sources and replace what
+// was there before instead of piling up:
+//   - admission: an allowed object replaces the results of that object, one without
+//     violations removes them; denied objects never exist and are not reported
+//   - background audit: every run replaces the results of all pods
+//
+// Results of a deleted pod are dropped right away, PodDeleted is called from the pod informer.
+package policyreport
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"webhooklite/internal/audit"
+)
+
+// Resource identifies a reported object
+type Resource struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+// Result is the outcome of one rule for one resource
+type Result struct {
+	Rule     string
+	Severity admission.Severity
+	// Action is the strongest action of the violations of the rule: deny, then audit, then warn
+	Action  admission.Action
+	Message string
+}
+
+type entry struct {
+	results []Result
+	// updated is when the results were recorded; admission results expire after Store.TTL
+	updated time.Time
+}
+
+// Store is the current set of results. Recording marks namespaces dirty,
+// Writer turns the dirty namespaces into reports.
+type Store struct {
+	// TTL drops admission results of objects that were not admitted again since, so results
+	// of deleted objects do not stay forever. Pods never expire, they are dropped by PodDeleted.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[Resource]*entry
+	dirty   map[string]bool
+}
+
+// NewStore creates an empty store
+func NewStore(ttl time.Duration) *Store {
+	return &Store{TTL: ttl, entries: make(map[Resource]*entry), dirty: make(map[string]bool)}
+}
+
+// Admitted is an admission.Recorder
+func (s *Store) Admitted(req *admissionv1.AdmissionRequest, decision *admission.Decision, allowed bool) {
+	// A generated name is not known yet, the audit reports such pods once they run
+	if !allowed || req.Name == "" {
+		return
+	}
+	// A dry run creates nothing, and the webhooks promise sideEffects: None
+	if req.DryRun != nil && *req.DryRun {
+		return
+	}
+	resource := Resource{
+		APIVersion: apiVersion(req.Kind.Group, req.Kind.Version),
+		Kind:       req.Kind.Kind,
+		Namespace:  req.Namespace,
+		Name:       req.Name,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(resource, results(decision.Violations), time.Now())
+}
+
+// Audited replaces the results of all pods with the audit report
+func (s *Store) Audited(report *audit.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for resource := range s.entries {
+		if isPod(resource) {
+			delete(s.entries, resource)
+			s.dirty[resource.Namespace] = true
+		}
+	}
+	for namespace, ns := range report.Namespaces {
+		byPod := make(map[string][]admission.Violation)
+		for _, f := range ns.Findings {
+			byPod[f.Pod] = append(byPod[f.Pod], f.Violation)
+		}
+		for pod, violations := range byPod {
+			resource := Resource{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: pod}
+			s.set(resource, results(violations), report.Finished)
+		}
+	}
+}
+
+// PodDeleted drops the results of a deleted pod. Without it they would stay until the next audit,
+// or for good when the audit is disabled.
+func (s *Store) PodDeleted(namespace, name string) {
+	resource := Resource{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[resource]; ok {
+		delete(s.entries, resource)
+		s.dirty[namespace] = true
+	}
+}
+
+// Load puts back results read from existing reports, e.g. after a restart.
+// Pods are skipped, the first audit reports them again.
+func (s *Store) Load(resource Resource, result Result, updated time.Time) {
+	if isPod(resource) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[resource]
+	if e == nil {
+		e = &entry{updated: updated}
+		s.entries[resource] = e
+	}
+	e.results = append(e.results, result)
+	if updated.After(e.updated) {
+		e.updated = updated
+	}
+}
+
+// MarkDirty makes the next Writer sync rewrite the report of namespace
+func (s *Store) MarkDirty(namespace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty[namespace] = true
+}
+
+// set must be called with mu held
+func (s *Store) set(resource Resource, results []Result, now time.Time) {
+	old, existed := s.entries[resource]
+	if len(results) == 0 {
+		if existed {
+			delete(s.entries, resource)
+			s.dirty[resource.Namespace] = true
+		}
+		return
+	}
+	if !existed || !slices.Equal(old.results, results) {
+		s.dirty[resource.Namespace] = true
+	}
+	s.entries[resource] = &entry{results: results, updated: now}
+}
+
+// expire drops admission results older than TTL
+func (s *Store) expire(now time.Time) {
+	if s.TTL <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for resource, e := range s.entries {
+		if !isPod(resource) && now.Sub(e.updated) > s.TTL {
+			delete(s.entries, resource)
+			s.dirty[resource.Namespace] = true
+		}
+	}
+}
+
+// takeDirty returns the namespaces that changed since the last call, "" is the cluster report
+func (s *Store) takeDirty() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	namespaces := make([]string, 0, len(s.dirty))
+	for namespace := range s.dirty {
+		namespaces = append(namespaces, namespace)
+	}
+	s.dirty = make(map[string]bool)
+	slices.Sort(namespaces)
+	return namespaces
+}
+
+// reported is one result with its resource, ready to be written
+type reported struct {
+	Resource
+	Result
+	updated time.Time
+}
+
+// namespace returns the results of namespace, sorted so unchanged reports stay byte-identical
+func (s *Store) namespace(namespace string) []reported {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []reported
+	for resource, e := range s.entries {
+		if resource.Namespace != namespace {
+			continue
+		}
+		for _, r := range e.results {
+			out = append(out, reported{Resource: resource, Result: r, updated: e.updated})
+		}
+	}
+	slices.SortFunc(out, func(a, b reported) int {
+		return strings.Compare(a.Kind+"/"+a.Name+"/"+a.Rule, b.Kind+"/"+b.Name+"/"+b.Rule)
+	})
+	return out
+}
+
+// results merges violations into one result per rule
+func results(violations []admission.Violation) []Result {
+	var out []Result
+	for _, v := range violations {
+		i := slices.IndexFunc(out, func(r Result) bool { return r.Rule == v.Rule })
+		if i < 0 {
+			out = append(out, Result{Rule: v.Rule, Severity: v.Severity, Action: v.Action, Message: v.Message})
+			continue
+		}
+		r := &out[i]
+		r.Message += "; " + v.Message
+		if slices.Index(outcomes, v.Action) < slices.Index(outcomes, r.Action) {
+			r.Action = v.Action
+		}
+		if slices.Index(admission.Severities, v.Severity) > slices.Index(admission.Severities, r.Severity) {
+			r.Severity = v.Severity
+		}
+	}
+	slices.SortFunc(out, func(a, b Result) int { return strings.Compare(a.Rule, b.Rule) })
+	return out
+}
+
+// outcomes orders actions for the report: audited violations fail the resource, warnings only warn
+var outcomes = []admission.Action{admission.ActionDeny, admission.ActionAudit, admission.ActionWarn}
+
+func isPod(resource Resource) bool {
+	return resource.APIVersion == "v1" && resource.Kind == "Pod"
+}
+
+func apiVersion(group, version string) string {
+	if group == "" {
+		return version
+	}
+	return group + "/" + version
+}
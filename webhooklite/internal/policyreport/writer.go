@@ -0,0 +1,220 @@
+package policyreport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"admission"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// API group and version of the reports; the CRDs come from kubernetes-sigs/wg-policy-prototypes
+const (
+	Group   = "wgpolicyk8s.io"
+	Version = "v1alpha2"
+
+	// ManagedByLabel marks the reports this webhook owns
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+)
+
+var (
+	policyReports        = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "policyreports"}
+	clusterPolicyReports = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "clusterpolicyreports"}
+)
+
+// Writer writes the namespaces the Store marked dirty as reports
+type Writer struct {
+	Client dynamic.Interface
+	// Name is the name of every report, their source and policy
+	Name  string
+	Store *Store
+
+	loaded bool
+}
+
+// Run syncs every interval until ctx is done; failed namespaces are retried on the next round
+func (w *Writer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Sync(ctx); err != nil {
+				log.Printf("⚠️  [%s] PolicyReport sync failed: %v", w.Name, err)
+			}
+		}
+	}
+}
+
+// Sync writes every dirty namespace. The first sync reads the reports left by a previous
+// run back into the Store, so a restart updates them instead of starting from scratch.
+func (w *Writer) Sync(ctx context.Context) error {
+	if !w.loaded {
+		if err := w.load(ctx); err != nil {
+			return fmt.Errorf("load existing reports: %w", err)
+		}
+		w.loaded = true
+	}
+	w.Store.expire(time.Now())
+
+	var errs []error
+	for _, namespace := range w.Store.takeDirty() {
+		if err := w.write(ctx, namespace); err != nil {
+			w.Store.MarkDirty(namespace)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// write creates, updates or deletes the report of one namespace ("" is the cluster report)
+func (w *Writer) write(ctx context.Context, namespace string) error {
+	client, kind := w.reports(namespace)
+	results := w.Store.namespace(namespace)
+
+	existing, err := client.Get(ctx, w.Name, metav1.GetOptions{})
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return fmt.Errorf("get %s %s: %w", kind, w.reportName(namespace), err)
+	}
+
+	if len(results) == 0 {
+		if notFound {
+			return nil
+		}
+		if err := client.Delete(ctx, w.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete %s %s: %w", kind, w.reportName(namespace), err)
+		}
+		log.Printf("📋 [%s] %s %s deleted, no violations left", w.Name, kind, w.reportName(namespace))
+		return nil
+	}
+
+	report := existing
+	if notFound {
+		report = &unstructured.Unstructured{}
+		report.SetAPIVersion(Group + "/" + Version)
+		report.SetKind(kind)
+		report.SetName(w.Name)
+		report.SetNamespace(namespace)
+		report.SetLabels(map[string]string{ManagedByLabel: w.Name})
+	}
+	report.Object["results"], report.Object["summary"] = w.content(results)
+
+	if notFound {
+		_, err = client.Create(ctx, report, metav1.CreateOptions{})
+	} else {
+		_, err = client.Update(ctx, report, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("write %s %s: %w", kind, w.reportName(namespace), err)
+	}
+	log.Printf("📋 [%s] %s %s: %d results", w.Name, kind, w.reportName(namespace), len(results))
+	return nil
+}
+
+// content builds results and summary in the v1alpha2 format
+func (w *Writer) content(results []reported) ([]any, map[string]any) {
+	summary := map[string]any{"pass": int64(0), "fail": int64(0), "warn": int64(0), "error": int64(0), "skip": int64(0)}
+	out := make([]any, 0, len(results))
+	for _, r := range results {
+		outcome := "fail"
+		if r.Action == admission.ActionWarn {
+			outcome = "warn"
+		}
+		summary[outcome] = summary[outcome].(int64) + 1
+
+		resource := map[string]any{"apiVersion": r.APIVersion, "kind": r.Kind, "name": r.Name}
+		if r.Namespace != "" {
+			resource["namespace"] = r.Namespace
+		}
+		out = append(out, map[string]any{
+			"source":     w.Name,
+			"policy":     w.Name,
+			"rule":       r.Rule,
+			"result":     outcome,
+			"severity":   string(r.Severity),
+			"message":    r.Message,
+			"scored":     true,
+			"timestamp":  map[string]any{"seconds": r.updated.Unix(), "nanos": int64(0)},
+			"resources":  []any{resource},
+			"properties": map[string]any{"action": string(r.Action)},
+		})
+	}
+	return out, summary
+}
+
+// load reads the results of our existing reports into the Store and marks their namespaces
+// dirty, so reports that no longer have results are deleted
+func (w *Writer) load(ctx context.Context) error {
+	selector := metav1.ListOptions{LabelSelector: ManagedByLabel + "=" + w.Name}
+	namespaced, err := w.Client.Resource(policyReports).Namespace(metav1.NamespaceAll).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	cluster, err := w.Client.Resource(clusterPolicyReports).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, report := range append(namespaced.Items, cluster.Items...) {
+		if report.GetName() != w.Name {
+			continue
+		}
+		w.Store.MarkDirty(report.GetNamespace())
+		results, _, _ := unstructured.NestedSlice(report.Object, "results")
+		for _, item := range results {
+			w.loadResult(report.GetNamespace(), item)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) loadResult(namespace string, item any) {
+	result, ok := item.(map[string]any)
+	if !ok {
+		return
+	}
+	resources, _, _ := unstructured.NestedSlice(result, "resources")
+	if len(resources) != 1 {
+		return
+	}
+	ref, _ := resources[0].(map[string]any)
+	str := func(m map[string]any, fields ...string) string {
+		s, _, _ := unstructured.NestedString(m, fields...)
+		return s
+	}
+	seconds, _, _ := unstructured.NestedInt64(result, "timestamp", "seconds")
+	w.Store.Load(
+		Resource{APIVersion: str(ref, "apiVersion"), Kind: str(ref, "kind"), Namespace: namespace, Name: str(ref, "name")},
+		Result{
+			Rule:     str(result, "rule"),
+			Severity: admission.Severity(str(result, "severity")),
+			Action:   admission.Action(str(result, "properties", "action")),
+			Message:  str(result, "message"),
+		},
+		time.Unix(seconds, 0),
+	)
+}
+
+func (w *Writer) reports(namespace string) (dynamic.ResourceInterface, string) {
+	if namespace == "" {
+		return w.Client.Resource(clusterPolicyReports), "ClusterPolicyReport"
+	}
+	return w.Client.Resource(policyReports).Namespace(namespace), "PolicyReport"
+}
+
+func (w *Writer) reportName(namespace string) string {
+	if namespace == "" {
+		return w.Name
+	}
+	return namespace + "/" + w.Name
+}
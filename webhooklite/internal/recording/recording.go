@@ -0,0 +1,293 @@
+// Package recording keeps a JSONL log of the admission requests /validate answered and
+// replays it through another policy, so a rule change can be checked against real traffic
+// before it is enforced.
+//
+// Requests are sanitised before they are written: Secret data, literal env values,
+// managedFields, the last-applied-configuration annotation and userInfo.extra are not recorded.
+// Rules that look at those fields can not be replayed faithfully.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"admission"
+	"admission/metrics"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Redacted replaces sanitised values
+const Redacted = "REDACTED"
+
+// Record is one line of a recording
+type Record struct {
+	Time    time.Time                     `json:"time"`
+	Request *admissionv1.AdmissionRequest `json:"request"`
+	// Namespace is the metadata of the request namespace as rules saw it, for namespaceObject
+	// and the Pod Security labels
+	Namespace *corev1.Namespace `json:"namespace,omitempty"`
+	// Allowed and Violations are the decision the webhook made
+	Allowed    bool                  `json:"allowed"`
+	Violations []admission.Violation `json:"violations,omitempty"`
+}
+
+// Writer appends records to a JSONL file. It is an admission.Recorder.
+// Record only queues the request; a goroutine sanitises, looks up the namespace and writes,
+// so recording never slows down admission. When the queue is full the record is dropped and
+// counted in admission_recording_dropped_total.
+type Writer struct {
+	file       *os.File
+	size       int64
+	maxSize    int64
+	namespaces admission.NamespaceGetter
+	full       bool
+
+	// mu guards queue against Close
+	mu       sync.RWMutex
+	queue    chan entry
+	closed   bool
+	done     chan struct{}
+	dropping atomic.Bool
+}
+
+type entry struct {
+	time       time.Time
+	request    *admissionv1.AdmissionRequest
+	allowed    bool
+	violations []admission.Violation
+}
+
+// QueueSize is how many requests may wait to be written before new ones are dropped
+const QueueSize = 1024
+
+// namespaceTimeout bounds the namespace lookup of one record
+const namespaceTimeout = 5 * time.Second
+
+// Create opens path for appending. Recording stops once the file reaches maxSize bytes
+// (0 means no limit); namespaces may be nil.
+func Create(path string, maxSize int64, namespaces admission.NamespaceGetter) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &Writer{
+		file:       file,
+		size:       info.Size(),
+		maxSize:    maxSize,
+		namespaces: namespaces,
+		queue:      make(chan entry, QueueSize),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Record queues a decision without blocking. Dry-run requests are not recorded, the
+// webhooks promise sideEffects: None for them.
+func (w *Writer) Record(req *admissionv1.AdmissionRequest, decision *admission.Decision, allowed bool) {
+	if req.DryRun != nil && *req.DryRun {
+		return
+	}
+	e := entry{time: time.Now().UTC(), request: req, allowed: allowed, violations: decision.Violations}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.queue <- e:
+		w.dropping.Store(false)
+	default:
+		metrics.RecordDroppedRecord("webhooklite")
+		if !w.dropping.Swap(true) {
+			log.Printf("⚠️  Recording queue is full, dropping records until %s catches up", w.file.Name())
+		}
+	}
+}
+
+// run writes queued records until Close; errors are logged, recording must never fail a request
+func (w *Writer) run() {
+	defer close(w.done)
+	for e := range w.queue {
+		if w.full {
+			continue
+		}
+		record := Record{
+			Time:       e.time,
+			Request:    Sanitize(e.request),
+			Allowed:    e.allowed,
+			Violations: e.violations,
+		}
+		if e.request.Namespace != "" && w.namespaces != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), namespaceTimeout)
+			if ns, err := w.namespaces(ctx, e.request.Namespace); err == nil {
+				record.Namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:        ns.Name,
+					Labels:      ns.Labels,
+					Annotations: ns.Annotations,
+				}}
+			}
+			cancel()
+		}
+		w.write(record)
+	}
+}
+
+func (w *Writer) write(record Record) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("❌ Could not record %s: %v", record.Request.UID, err)
+		return
+	}
+	line = append(line, '\n')
+
+	if w.maxSize > 0 && w.size+int64(len(line)) > w.maxSize {
+		w.full = true
+		log.Printf("⚠️  Recording %s reached %d bytes, recording stopped", w.file.Name(), w.maxSize)
+		return
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		log.Printf("❌ Could not record %s: %v", record.Request.UID, err)
+	}
+}
+
+// Close writes what is still queued and closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	<-w.done
+	return w.file.Close()
+}
+
+// Sanitize returns a copy of req without secrets and noise, see the package comment
+func Sanitize(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	out := req.DeepCopy()
+	out.UserInfo.Extra = nil
+	out.Object.Raw = sanitizeObject(out.Object.Raw)
+	out.OldObject.Raw = sanitizeObject(out.OldObject.Raw)
+	out.Object.Object, out.OldObject.Object = nil, nil
+	return out
+}
+
+func sanitizeObject(raw []byte) []byte {
+	obj, err := admission.Unstructured(raw)
+	if err != nil || obj == nil {
+		return raw
+	}
+	if metadata, ok := obj["metadata"].(map[string]any); ok {
+		delete(metadata, "managedFields")
+		if annotations, ok := metadata["annotations"].(map[string]any); ok {
+			delete(annotations, corev1.LastAppliedConfigAnnotation)
+		}
+	}
+	if obj["kind"] == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			if data, ok := obj[field].(map[string]any); ok {
+				for k := range data {
+					data[k] = Redacted
+				}
+			}
+		}
+	}
+	redactEnv(obj)
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// redactEnv replaces literal values of env entries anywhere in the object (pods and pod templates);
+// valueFrom references stay, they are not secret
+func redactEnv(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if env, ok := item.([]any); ok && k == "env" {
+				for _, e := range env {
+					if e, ok := e.(map[string]any); ok {
+						if _, ok := e["value"]; ok {
+							e["value"] = Redacted
+						}
+					}
+				}
+				continue
+			}
+			redactEnv(item)
+		}
+	case []any:
+		for _, item := range v {
+			redactEnv(item)
+		}
+	}
+}
+
+// ErrEmpty is returned for a recording without records
+var ErrEmpty = errors.New("recording has no records")
+
+// maxLine bounds one record, the API server limits objects to a few MB
+const maxLine = 16 << 20
+
+// Read loads a recording. Lines that can not be decoded are reported with their line number
+// and skipped, the rest is returned.
+func Read(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	var errs []error
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", path, line, err))
+			continue
+		}
+		if r.Request == nil {
+			errs = append(errs, fmt.Errorf("%s:%d: no request", path, line))
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", path, err))
+	}
+	if len(records) == 0 && len(errs) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrEmpty)
+	}
+	return records, errors.Join(errs...)
+}
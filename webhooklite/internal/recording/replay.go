@@ -0,0 +1,136 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"admission"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Flip is a recorded decision the new policy decides the other way
+type Flip struct {
+	Record
+	// Now is what the new policy decided; Denied lists its deny violations
+	Now    bool                  `json:"nowAllowed"`
+	Denied []admission.Violation `json:"deniedBy,omitempty"`
+}
+
+// Object is "Kind namespace/name" like in the webhook logs
+func (f Flip) Object() string {
+	req := f.Request
+	if req.Namespace == "" {
+		return fmt.Sprintf("%s %s", req.Kind.Kind, req.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", req.Kind.Kind, req.Namespace, req.Name)
+}
+
+// Result is the outcome of a replay
+type Result struct {
+	Replayed int `json:"replayed"`
+	// NowDenied were allowed and would be denied, NowAllowed the other way round
+	NowDenied  []Flip `json:"nowDenied"`
+	NowAllowed []Flip `json:"nowAllowed"`
+	// Errors are records the new policy could not decide
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Flipped reports whether any decision changed
+func (r *Result) Flipped() bool {
+	return len(r.NowDenied) > 0 || len(r.NowAllowed) > 0
+}
+
+// Replay decides every record again with the policy of handler. The handler should get
+// Namespaces(records) as its namespace getter. Exceptions are checked against the current
+// time, an exception that expired since the recording flips too.
+func Replay(handler *admission.Handler, records []Record) *Result {
+	result := &Result{NowDenied: []Flip{}, NowAllowed: []Flip{}}
+	for _, record := range records {
+		decision, err := handler.Decide(record.Request)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", record.Request.UID, err))
+			continue
+		}
+		result.Replayed++
+
+		denied := admission.ByAction(decision.Violations)[admission.ActionDeny]
+		allowed := len(denied) == 0
+		switch {
+		case record.Allowed && !allowed:
+			result.NowDenied = append(result.NowDenied, Flip{Record: record, Now: allowed, Denied: denied})
+		case !record.Allowed && allowed:
+			result.NowAllowed = append(result.NowAllowed, Flip{Record: record, Now: allowed})
+		}
+	}
+	return result
+}
+
+// Namespaces serves the namespaces stored in the records, the latest one wins
+func Namespaces(records []Record) admission.NamespaceGetter {
+	namespaces := make(map[string]*corev1.Namespace)
+	for _, r := range records {
+		if r.Namespace != nil {
+			namespaces[r.Namespace.Name] = r.Namespace
+		}
+	}
+	return func(_ context.Context, name string) (*corev1.Namespace, error) {
+		if ns, ok := namespaces[name]; ok {
+			return ns, nil
+		}
+		return nil, apierrors.NewNotFound(corev1.Resource("namespaces"), name)
+	}
+}
+
+// Formats the result can be written in
+var Formats = []string{"text", "json"}
+
+// Write prints the result in one of Formats
+func Write(w io.Writer, result *Result, format string) error {
+	switch format {
+	case "text":
+		return writeText(w, result)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	default:
+		return fmt.Errorf("unknown format %q (supported: %v)", format, Formats)
+	}
+}
+
+func writeText(w io.Writer, result *Result) error {
+	for _, f := range result.NowDenied {
+		msgs := make([]string, 0, len(f.Denied))
+		for _, v := range f.Denied {
+			msgs = append(msgs, v.String())
+		}
+		if _, err := fmt.Fprintf(w, "allowed -> denied: %s %s (%s, %s): %s\n", f.Request.Operation, f.Object(),
+			f.Request.UserInfo.Username, f.Time.Format(time.RFC3339), strings.Join(msgs, "; ")); err != nil {
+			return err
+		}
+	}
+	for _, f := range result.NowAllowed {
+		msgs := make([]string, 0, len(f.Violations))
+		for _, v := range admission.ByAction(f.Violations)[admission.ActionDeny] {
+			msgs = append(msgs, v.String())
+		}
+		if _, err := fmt.Fprintf(w, "denied -> allowed: %s %s (%s, %s), was: %s\n", f.Request.Operation, f.Object(),
+			f.Request.UserInfo.Username, f.Time.Format(time.RFC3339), strings.Join(msgs, "; ")); err != nil {
+			return err
+		}
+	}
+	for _, e := range result.Errors {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d requests replayed: %d now denied, %d now allowed, %d errors\n",
+		result.Replayed, len(result.NowDenied), len(result.NowAllowed), len(result.Errors))
+	return err
+}
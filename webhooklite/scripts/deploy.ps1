@@ -9,9 +9,8 @@ Write-Host "🚀 Deploying webhook to namespace $Namespace" -ForegroundColor Cya
 Write-Host "📦 Creating namespace..." -ForegroundColor Yellow
 kubectl apply -f deployments\00-namespace.yaml
 
-# 2. Generate certificates and secret
-Write-Host "🔐 Generating certificates..." -ForegroundColor Yellow
-& "$PSScriptRoot\gen-certs.ps1"
+# 2. Certificates: webhooklite runs with -manage-certs, it creates the webhook-certs Secret
+# and fills in the caBundle of both configurations itself (gen-certs.ps1 is for -tls-cert)
 
 # 3. Apply RBAC
 Write-Host "🔑 Applying RBAC..." -ForegroundColor Yellow
@@ -19,12 +18,16 @@ kubectl apply -f deployments\01-rbac.yaml
 
 # 4. Build and load image
 Write-Host "🛠️ Building Docker image..." -ForegroundColor Yellow
-docker build -t webhooklite:latest -f build\Dockerfile .
+# The build context is the repository root because of the shared admission module
+docker build -t webhooklite:latest -f build\Dockerfile ..
 
 # For Kind cluster:
 # kind load docker-image webhooklite:latest --name your-cluster-name
 
-# 5. Apply deployment
+# 5. Apply policy and deployment
+Write-Host "📜 Applying policy..." -ForegroundColor Yellow
+kubectl apply -f deployments\06-policy.yaml
+
 Write-Host "🚀 Applying deployment..." -ForegroundColor Yellow
 kubectl apply -f deployments\03-deployment.yaml
 
@@ -36,16 +39,12 @@ kubectl apply -f deployments\04-service.yaml
 Write-Host "⏳ Waiting for pod to be ready..." -ForegroundColor Yellow
 kubectl wait --for=condition=ready pod -l app=webhook -n $Namespace --timeout=60s
 
-# 8. Get caBundle and update validator
-Write-Host "🔑 Updating validator with caBundle..." -ForegroundColor Yellow
-$caBundle = [Convert]::ToBase64String([System.IO.File]::ReadAllBytes("certs\tls.crt"))
-$validatorPath = "deployments\05-validator.yaml"
-$content = Get-Content $validatorPath -Raw
-$content = $content -replace 'caBundle: ""', "caBundle: $caBundle"
-$content | Set-Content $validatorPath
+# 8. Apply validator and mutator, caBundle is patched by the webhook within seconds
+Write-Host "🛡️ Applying validator..." -ForegroundColor Yellow
+kubectl apply -f deployments\05-validator.yaml
 
-# 9. Apply validator
-kubectl apply -f $validatorPath
+Write-Host "🩹 Applying mutator..." -ForegroundColor Yellow
+kubectl apply -f deployments\07-mutator.yaml
 
 Write-Host "✅ Deployment complete!" -ForegroundColor Green
 Write-Host ""